@@ -0,0 +1,218 @@
+// +build linux
+
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+
+Copyright 2016 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package collector
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"os/user"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/intelsdi-x/snap/core/serror"
+)
+
+const (
+	//redactedArg replaces arguments which are marked in setfile as redacted
+	redactedArg = "<redacted>"
+
+	//auditTailSize max number of bytes read from the end of existing audit log to continue hash chain
+	auditTailSize = 64 * 1024
+)
+
+// auditRecord is a single entry of audit log,
+// hash is computed over JSON encoding of the record without hash field,
+// prev_hash links record with the previous one so removing or modifying records breaks the chain
+type auditRecord struct {
+	Timestamp  string   `json:"timestamp"`
+	Metric     string   `json:"metric"`
+	Exec       string   `json:"exec"`
+	Args       []string `json:"args"`
+	ScriptHash string   `json:"script_sha256,omitempty"`
+	User       string   `json:"user"`
+	ExitCode   int      `json:"exit_code"`
+	Duration   float64  `json:"duration_sec"`
+	OutputHash string   `json:"output_sha256"`
+	Error      string   `json:"error,omitempty"`
+	PrevHash   string   `json:"prev_hash"`
+	Hash       string   `json:"hash,omitempty"`
+}
+
+// auditLog append-only JSON lines file with records of executed commands
+type auditLog struct {
+	*rotatingFile
+	mu       sync.Mutex
+	lastHash string
+	user     string
+}
+
+// newAuditLog opens audit log file, existing file is appended and its hash chain is continued
+func newAuditLog(path string, maxSize int64, maxBackups int) (*auditLog, error) {
+	lastHash, err := readLastHash(path)
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := openRotatingFile(path, maxSize, maxBackups)
+	if err != nil {
+		return nil, err
+	}
+	return &auditLog{rotatingFile: file, lastHash: lastHash, user: currentUser()}, nil
+}
+
+// record writes information about single execution of metric command to audit log
+func (a *auditLog) record(name string, m metric, output []byte, serr serror.SnapError, duration time.Duration) error {
+	execPath, err := exec.LookPath(m.Exec)
+	if err != nil {
+		execPath = m.Exec
+	}
+
+	outputHash := sha256.Sum256(output)
+	r := auditRecord{
+		Timestamp:  time.Now().UTC().Format(time.RFC3339Nano),
+		Metric:     name,
+		Exec:       execPath,
+		Args:       redactArgs(m.Args, m.RedactArgs),
+		User:       a.user,
+		ExitCode:   exitCodeOf(serr),
+		Duration:   duration.Seconds(),
+		OutputHash: hex.EncodeToString(outputHash[:]),
+	}
+	if m.Script != "" {
+		r.ScriptHash = scriptHash(m.Script)
+	}
+	if serr != nil {
+		r.Error = serr.Error()
+	}
+
+	return a.write(r)
+}
+
+// write appends record to audit log, the file is rotated when it exceeds max size
+func (a *auditLog) write(r auditRecord) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	r.PrevHash = a.lastHash
+	r.Hash = ""
+	unhashed, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	hash := sha256.Sum256(unhashed)
+	r.Hash = hex.EncodeToString(hash[:])
+
+	line, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+
+	if _, err := a.rotatingFile.Write(line); err != nil {
+		return err
+	}
+	a.lastHash = r.Hash
+	return nil
+}
+
+// close closes audit log file
+func (a *auditLog) close() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.rotatingFile.Close()
+}
+
+// readLastHash returns hash of the last record in existing audit log
+func readLastHash(path string) (string, error) {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	fi, err := f.Stat()
+	if err != nil {
+		return "", err
+	}
+	offset := fi.Size() - auditTailSize
+	if offset < 0 {
+		offset = 0
+	}
+	tail := make([]byte, fi.Size()-offset)
+	if _, err := f.ReadAt(tail, offset); err != nil && err != io.EOF {
+		return "", err
+	}
+
+	lines := bytes.Split(bytes.TrimSpace(tail), []byte("\n"))
+	last := lines[len(lines)-1]
+	if len(last) == 0 {
+		return "", nil
+	}
+
+	var r auditRecord
+	if err := json.Unmarshal(last, &r); err != nil {
+		return "", fmt.Errorf("Cannot continue audit log %s, last record is corrupted: %v", path, err)
+	}
+	return r.Hash, nil
+}
+
+// redactArgs returns copy of arguments with redacted values at given indexes
+func redactArgs(args []string, redacted []int) []string {
+	out := make([]string, len(args))
+	copy(out, args)
+	for _, i := range redacted {
+		if i >= 0 && i < len(out) {
+			out[i] = redactedArg
+		}
+	}
+	return out
+}
+
+// exitCodeOf returns exit code of command based on error returned by exeCmd, -1 means that exit code is unknown
+func exitCodeOf(serr serror.SnapError) int {
+	if serr == nil {
+		return 0
+	}
+	if code, ok := serr.Fields()[exitCodeField].(int); ok {
+		return code
+	}
+	return -1
+}
+
+// currentUser returns name of user running the plugin
+func currentUser() string {
+	u, err := user.Current()
+	if err != nil {
+		return strconv.Itoa(os.Geteuid())
+	}
+	return u.Username
+}
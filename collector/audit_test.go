@@ -0,0 +1,138 @@
+// +build linux
+
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+
+Copyright 2016 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package collector
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/intelsdi-x/snap/core/serror"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestAuditLog(t *testing.T) {
+	Convey("Writing audit log", t, func() {
+		dir, err := ioutil.TempDir("", "exec-audit")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+		path := filepath.Join(dir, "audit.log")
+
+		m := metric{Exec: "/bin/echo", Type: "string", Args: []string{"-p", "secret"}, RedactArgs: []int{1}}
+
+		Convey("records are chained and arguments are redacted", func() {
+			audit, err := newAuditLog(path, 0, 0)
+			So(err, ShouldBeNil)
+			So(audit.record("metric0", m, []byte("65"), nil, time.Second), ShouldBeNil)
+			So(audit.record("metric0", m, nil, serror.New(fmt.Errorf("exit status 2"), map[string]interface{}{exitCodeField: 2}), time.Second), ShouldBeNil)
+			audit.close()
+
+			records := readAuditRecords(path)
+			So(len(records), ShouldEqual, 2)
+			So(records[0].Args, ShouldResemble, []string{"-p", redactedArg})
+			So(records[0].ExitCode, ShouldEqual, 0)
+			So(records[1].ExitCode, ShouldEqual, 2)
+			So(records[1].PrevHash, ShouldEqual, records[0].Hash)
+			So(verifyAuditRecords(records), ShouldBeTrue)
+
+			Convey("and chain is continued after reopening", func() {
+				audit, err := newAuditLog(path, 0, 0)
+				So(err, ShouldBeNil)
+				So(audit.record("metric1", m, nil, nil, time.Second), ShouldBeNil)
+				audit.close()
+
+				records := readAuditRecords(path)
+				So(len(records), ShouldEqual, 3)
+				So(records[2].PrevHash, ShouldEqual, records[1].Hash)
+				So(verifyAuditRecords(records), ShouldBeTrue)
+			})
+
+			Convey("and modification of record breaks the chain", func() {
+				records[0].ExitCode = 1
+				So(verifyAuditRecords(records), ShouldBeFalse)
+			})
+		})
+
+		Convey("log is rotated when it exceeds max size", func() {
+			audit, err := newAuditLog(path, 1, 2)
+			So(err, ShouldBeNil)
+			for i := 0; i < 4; i++ {
+				So(audit.record("metric0", m, nil, nil, time.Second), ShouldBeNil)
+			}
+			audit.close()
+
+			So(len(readAuditRecords(path)), ShouldEqual, 1)
+			So(len(readAuditRecords(backupPath(path, 1))), ShouldEqual, 1)
+			So(len(readAuditRecords(backupPath(path, 2))), ShouldEqual, 1)
+			_, err = os.Stat(backupPath(path, 3))
+			So(os.IsNotExist(err), ShouldBeTrue)
+		})
+
+		Convey("existing log with corrupted last record is refused", func() {
+			So(ioutil.WriteFile(path, []byte("{\"hash\": "), 0600), ShouldBeNil)
+			_, err := newAuditLog(path, 0, 0)
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
+
+func TestExitCodeOf(t *testing.T) {
+	Convey("Getting exit code of command", t, func() {
+		So(exitCodeOf(nil), ShouldEqual, 0)
+		So(exitCodeOf(serror.New(fmt.Errorf("Error"))), ShouldEqual, -1)
+		So(exitCodeOf(serror.New(fmt.Errorf("Error"), map[string]interface{}{exitCodeField: 3})), ShouldEqual, 3)
+	})
+}
+
+func readAuditRecords(path string) []auditRecord {
+	content, _ := ioutil.ReadFile(path)
+	records := []auditRecord{}
+	for _, line := range bytes.Split(bytes.TrimSpace(content), []byte("\n")) {
+		var r auditRecord
+		if json.Unmarshal(line, &r) == nil {
+			records = append(records, r)
+		}
+	}
+	return records
+}
+
+func verifyAuditRecords(records []auditRecord) bool {
+	prevHash := ""
+	for _, r := range records {
+		hash := r.Hash
+		r.Hash = ""
+		unhashed, _ := json.Marshal(r)
+		sum := sha256.Sum256(unhashed)
+		if r.PrevHash != prevHash || hex.EncodeToString(sum[:]) != hash {
+			return false
+		}
+		prevHash = hash
+	}
+	return true
+}
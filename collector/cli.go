@@ -0,0 +1,454 @@
+// +build linux
+
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+
+Copyright 2016 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package collector
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/intelsdi-x/snap-plugin-lib-go/v1/plugin"
+)
+
+const (
+	//tableOutput results printed as aligned table
+	tableOutput = "table"
+
+	//jsonOutput results printed as JSON
+	jsonOutput = "json"
+
+	//defaultListenAddress address on which serve command listens by default
+	defaultListenAddress = "localhost:9775"
+)
+
+// cliUsage describes subcommands of plugin binary
+const cliUsage = `Usage: %s <command> [options] [metric...]
+
+Commands:
+  validate    load setfile and report errors
+  list        print metrics defined in setfile
+  show        print definitions of metrics merged with defaults and templates
+  collect     execute metrics once and print their values, requires --once
+  serve       serve metrics on /metrics in Prometheus exposition format
+  run         collect metrics on their intervals and write results to stdout or file
+
+Run '%s <command> -h' to see options of command.
+`
+
+// cliOptions options of subcommands of plugin binary
+type cliOptions struct {
+	setFile           string
+	setFileFormat     string
+	strictPermissions bool
+	namespacePrefix   string
+	execTimeout       int
+	output            string
+	once              bool
+	taskConfig        configFlag
+	listen            string
+	cacheTTL          time.Duration
+	scrapeTimeout     time.Duration
+	interval          time.Duration
+	jitter            time.Duration
+	format            string
+	outputFile        string
+	outputMaxSize     int
+	outputMaxBackups  int
+}
+
+// configFlag task config of metrics given as repeated key=value options
+type configFlag map[string]string
+
+func (c configFlag) String() string {
+	pairs := []string{}
+	for k, v := range c {
+		pairs = append(pairs, k+"="+v)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
+
+func (c configFlag) Set(value string) error {
+	parts := strings.SplitN(value, "=", 2)
+	if len(parts) != 2 || parts[0] == "" {
+		return fmt.Errorf("expected key=value, got %s", value)
+	}
+	c[parts[0]] = parts[1]
+	return nil
+}
+
+// config returns configuration of plugin equivalent to Global Config in snap daemon
+func (o *cliOptions) config() plugin.Config {
+	cfg := plugin.Config{
+		setFileConfigVar:           o.setFile,
+		execTimeOutConfigVar:       int64(o.execTimeout),
+		strictPermissionsConfigVar: o.strictPermissions,
+	}
+	if o.setFileFormat != "" {
+		cfg[setFileFormatConfigVar] = o.setFileFormat
+	}
+	if o.namespacePrefix != "" {
+		cfg[namespacePrefixConfigVar] = o.namespacePrefix
+	}
+	for k, v := range o.taskConfig {
+		cfg[k] = v
+	}
+	return cfg
+}
+
+// listedMetric metric printed by list command
+type listedMetric struct {
+	Namespace   string            `json:"namespace"`
+	Type        string            `json:"type"`
+	Exec        string            `json:"exec"`
+	Unit        string            `json:"unit,omitempty"`
+	Description string            `json:"description,omitempty"`
+	Tags        map[string]string `json:"tags,omitempty"`
+}
+
+// collectedMetric result of collection printed by collect command
+type collectedMetric struct {
+	Namespace   string      `json:"namespace"`
+	Type        string      `json:"type"`
+	Value       interface{} `json:"value"`
+	DurationSec float64     `json:"duration_sec"`
+	Error       string      `json:"error,omitempty"`
+}
+
+// byNamespace sorts metrics by their namespaces
+type byNamespace []plugin.Metric
+
+func (m byNamespace) Len() int      { return len(m) }
+func (m byNamespace) Swap(i, j int) { m[i], m[j] = m[j], m[i] }
+func (m byNamespace) Less(i, j int) bool {
+	return m[i].Namespace.String() < m[j].Namespace.String()
+}
+
+// RunCommand runs subcommand of plugin binary which allows to test setfile without snap daemon,
+// it returns false if args do not start with name of subcommand, then the binary should be started as snap plugin
+func RunCommand(program string, args []string, stdout io.Writer, stderr io.Writer) (int, bool) {
+	if len(args) == 0 {
+		return 0, false
+	}
+
+	switch args[0] {
+	case "validate", "list", "show", "collect", "serve", "run":
+	case "help", "-h", "-help", "--help":
+		fmt.Fprintf(stdout, cliUsage, program, program)
+		return 0, true
+	default:
+		return 0, false
+	}
+
+	opts := &cliOptions{taskConfig: configFlag{}}
+	flags := flag.NewFlagSet(program+" "+args[0], flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	flags.StringVar(&opts.setFile, "setfile", "", "path to setfile, directory with setfiles or glob pattern (required)")
+	flags.StringVar(&opts.setFileFormat, "setfile-format", "", "format of setfile: json, yaml or toml, by default based on extension")
+	flags.BoolVar(&opts.strictPermissions, "strict-permissions", false, "refuse setfiles and executables with insecure permissions")
+	flags.StringVar(&opts.namespacePrefix, "namespace-prefix", "", "prefix of namespaces of metrics, by default /"+defaultNamespacePrefix)
+	if args[0] == "list" || args[0] == "collect" {
+		flags.StringVar(&opts.output, "output", tableOutput, "output format: table or json")
+	}
+	if args[0] == "collect" || args[0] == "serve" {
+		flags.IntVar(&opts.execTimeout, "execution-timeout", 10, "time in seconds after which warning about long execution is logged")
+	}
+	if args[0] == "run" {
+		flags.IntVar(&opts.execTimeout, "execution-timeout", 10, "time in seconds after which commands are killed")
+	}
+	if args[0] == "collect" || args[0] == "serve" || args[0] == "run" {
+		flags.Var(opts.taskConfig, "config", "task config of metrics as key=value, can be repeated")
+	}
+	if args[0] == "collect" {
+		flags.BoolVar(&opts.once, "once", false, "execute metrics once and exit")
+	}
+	if args[0] == "serve" {
+		flags.StringVar(&opts.listen, "listen", defaultListenAddress, "address on which metrics are served")
+		flags.DurationVar(&opts.cacheTTL, "cache", 0, "time for which results are reused by subsequent scrapes, e.g. 10s")
+		flags.DurationVar(&opts.scrapeTimeout, "scrape-timeout", 10*time.Second, "time after which commands are killed")
+	}
+	if args[0] == "run" {
+		flags.DurationVar(&opts.interval, "interval", 10*time.Second, "interval of metrics which do not define interval in setfile")
+		flags.DurationVar(&opts.jitter, "jitter", time.Second, "max random delay of the first execution of each metric")
+		flags.StringVar(&opts.format, "format", jsonLinesFormat, "format of results: json, csv or influx")
+		flags.StringVar(&opts.outputFile, "output-file", "", "file to which results are written, by default stdout")
+		flags.IntVar(&opts.outputMaxSize, "output-max-size", defaultOutputMaxSize, "max size of output file in megabytes, after which it is rotated")
+		flags.IntVar(&opts.outputMaxBackups, "output-max-backups", defaultOutputMaxBackups, "number of rotated output files which are kept")
+	}
+	if err := flags.Parse(args[1:]); err != nil {
+		if err == flag.ErrHelp {
+			return 0, true
+		}
+		return 2, true
+	}
+
+	if opts.setFile == "" {
+		fmt.Fprintln(stderr, "Error: -setfile is required")
+		return 2, true
+	}
+	if opts.output != "" && opts.output != tableOutput && opts.output != jsonOutput {
+		fmt.Fprintf(stderr, "Error: unsupported output format %s, expected %s or %s\n", opts.output, tableOutput, jsonOutput)
+		return 2, true
+	}
+
+	if opts.format != "" {
+		if err := validateSampleFormat(opts.format); err != nil {
+			fmt.Fprintf(stderr, "Error: %v\n", err)
+			return 2, true
+		}
+	}
+	if args[0] == "run" && opts.interval <= 0 {
+		fmt.Fprintln(stderr, "Error: -interval must be positive")
+		return 2, true
+	}
+
+	if args[0] == "collect" && !opts.once {
+		fmt.Fprintln(stderr, "Error: collect requires --once")
+		return 2, true
+	}
+
+	//only problems are logged, results are printed to stdout
+	log.SetLevel(log.WarnLevel)
+
+	p := New()
+	defer p.Close()
+	mts, err := p.GetMetricTypes(opts.config())
+	if err != nil {
+		fmt.Fprintf(stderr, "Error: %v\n", err)
+		return 1, true
+	}
+	sort.Sort(byNamespace(mts))
+
+	//metric types were returned, so prefix and catalog are valid
+	prefix, _ := getNamespacePrefix(opts.config())
+	catalog, _ := p.currentSetFile().catalog(prefix)
+
+	switch args[0] {
+	case "validate":
+		fmt.Fprintf(stdout, "Settings file %s is valid, %d metrics defined\n", opts.setFile, len(mts))
+		return 0, true
+	case "list":
+		listed := []listedMetric{}
+		rows := [][]string{}
+		metrics := p.currentSetFile().metrics
+		for _, mt := range mts {
+			entry := catalog[namespaceKey(mt.Namespace)]
+			m := metrics[entry.name]
+			listed = append(listed, listedMetric{
+				Namespace:   mt.Namespace.String(),
+				Type:        m.valueType(entry.column),
+				Exec:        m.executable(),
+				Unit:        mt.Unit,
+				Description: mt.Description,
+				Tags:        mt.Tags,
+			})
+			rows = append(rows, []string{mt.Namespace.String(), m.valueType(entry.column), m.executable(), tableCell(mt.Unit), tableCell(mt.Description)})
+		}
+		return printResults(stdout, stderr, opts.output, listed, []string{"NAMESPACE", "TYPE", "EXEC", "UNIT", "DESCRIPTION"}, rows), true
+	case "show":
+		return runShow(p, mts, catalog, flags.Args(), stdout, stderr)
+	case "serve":
+		return runServe(p, opts, stderr)
+	case "run":
+		return runScheduler(p, opts, stdout, stderr)
+	default:
+		return runCollectOnce(p, mts, catalog, flags.Args(), opts, stdout, stderr)
+	}
+}
+
+// runServe serves metrics in Prometheus exposition format until the server fails
+func runServe(p *Plugin, opts *cliOptions, stderr io.Writer) (int, bool) {
+	server := &http.Server{
+		Addr:    opts.listen,
+		Handler: newExporter(p, opts.config(), opts.cacheTTL, opts.scrapeTimeout),
+	}
+	fmt.Fprintf(stderr, "Serving metrics on http://%s%s\n", opts.listen, exporterPath)
+	if err := server.ListenAndServe(); err != nil {
+		fmt.Fprintf(stderr, "Error: %v\n", err)
+		return 1, true
+	}
+	return 0, true
+}
+
+// runScheduler collects metrics on their intervals until the process is interrupted
+func runScheduler(p *Plugin, opts *cliOptions, stdout io.Writer, stderr io.Writer) (int, bool) {
+	out := stdout
+	if opts.outputFile != "" {
+		file, err := openRotatingFile(opts.outputFile, int64(opts.outputMaxSize)*1024*1024, opts.outputMaxBackups)
+		if err != nil {
+			fmt.Fprintf(stderr, "Error: %v\n", err)
+			return 1, true
+		}
+		defer file.Close()
+		out = file
+	}
+
+	stop := make(chan struct{})
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(signals)
+	go func() {
+		<-signals
+		close(stop)
+	}()
+
+	newScheduler(p, opts.config(), opts.interval, opts.jitter, time.Duration(opts.execTimeout)*time.Second, opts.format, out).run(stop)
+	return 0, true
+}
+
+// runShow prints definitions of selected metrics, or all metrics if none is selected, as they are used by plugin
+func runShow(p *Plugin, mts []plugin.Metric, catalog map[string]catalogEntry, selected []string, stdout io.Writer, stderr io.Writer) (int, bool) {
+	mts, ok := selectMetrics(mts, catalog, selected, stderr)
+	if !ok {
+		return 1, true
+	}
+	definitions := map[string]interface{}{}
+	metrics := p.currentSetFile().metrics
+	for _, mt := range mts {
+		name := catalog[namespaceKey(mt.Namespace)].name
+		definitions[name] = definitionOf(metrics[name])
+	}
+	return printResults(stdout, stderr, jsonOutput, definitions, nil, nil), true
+}
+
+// selectMetrics returns metrics given by names or namespaces, or all metrics if none is given
+func selectMetrics(mts []plugin.Metric, catalog map[string]catalogEntry, selected []string, stderr io.Writer) ([]plugin.Metric, bool) {
+	if len(selected) == 0 {
+		return mts, true
+	}
+	byName := map[string]plugin.Metric{}
+	for _, mt := range mts {
+		byName[mt.Namespace.String()] = mt
+		byName[catalog[namespaceKey(mt.Namespace)].name] = mt
+	}
+	selectedMts := []plugin.Metric{}
+	for _, name := range selected {
+		mt, ok := byName[name]
+		if !ok {
+			fmt.Fprintf(stderr, "Error: metric %s is not defined in settings file\n", name)
+			return nil, false
+		}
+		selectedMts = append(selectedMts, mt)
+	}
+	return selectedMts, true
+}
+
+// runCollectOnce executes selected metrics, or all metrics if none is selected, and prints results
+func runCollectOnce(p *Plugin, mts []plugin.Metric, catalog map[string]catalogEntry, selected []string, opts *cliOptions, stdout io.Writer, stderr io.Writer) (int, bool) {
+	mts, ok := selectMetrics(mts, catalog, selected, stderr)
+	if !ok {
+		return 1, true
+	}
+	if len(mts) == 0 {
+		fmt.Fprintln(stderr, "Error: no metrics to collect")
+		return 1, true
+	}
+
+	config := opts.config()
+	for i := range mts {
+		mts[i].Config = config
+	}
+
+	results, serr := p.collect(mts)
+	if serr != nil {
+		fmt.Fprintf(stderr, "Error: %v\n", serr)
+		return 1, true
+	}
+
+	exitCode := 0
+	collected := []collectedMetric{}
+	rows := [][]string{}
+	metrics := p.currentSetFile().metrics
+	for i, r := range results {
+		c := collectedMetric{
+			Namespace:   mts[i].Namespace.String(),
+			Type:        metrics[r.name].valueType(r.column),
+			DurationSec: r.duration.Seconds(),
+		}
+		if r.err != nil {
+			c.Error = r.err.Error()
+			exitCode = 1
+		}
+		//metric without values and errors is printed too, e.g. first sample of counter
+		values := []collectedMetric{c}
+		if r.err == nil && len(r.metrics) > 0 {
+			values = values[:0]
+			for _, mt := range r.metrics {
+				c.Namespace = mt.Namespace.String()
+				c.Value = mt.Data
+				values = append(values, c)
+			}
+		}
+		for _, c := range values {
+			collected = append(collected, c)
+			rows = append(rows, []string{c.Namespace, c.Type, tableCell(c.Value), fmt.Sprintf("%.3fs", c.DurationSec), tableCell(c.Error)})
+		}
+	}
+
+	if code := printResults(stdout, stderr, opts.output, collected, []string{"NAMESPACE", "TYPE", "VALUE", "DURATION", "ERROR"}, rows); code != 0 {
+		return code, true
+	}
+	return exitCode, true
+}
+
+// printResults prints results as JSON or as table with given columns, it returns exit code
+func printResults(stdout io.Writer, stderr io.Writer, output string, results interface{}, columns []string, rows [][]string) int {
+	if output == jsonOutput {
+		enc := json.NewEncoder(stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(results); err != nil {
+			fmt.Fprintf(stderr, "Error: %v\n", err)
+			return 1
+		}
+		return 0
+	}
+
+	w := tabwriter.NewWriter(stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, strings.Join(columns, "\t"))
+	for _, row := range rows {
+		fmt.Fprintln(w, strings.Join(row, "\t"))
+	}
+	w.Flush()
+	return 0
+}
+
+// tableCell formats value as single table cell
+func tableCell(value interface{}) string {
+	if value == nil {
+		return "-"
+	}
+	s := fmt.Sprint(value)
+	if s == "" {
+		return "-"
+	}
+	return strings.Replace(s, "\n", "\\n", -1)
+}
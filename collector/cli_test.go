@@ -0,0 +1,190 @@
+// +build linux
+
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+
+Copyright 2016 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package collector
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestRunCommand(t *testing.T) {
+	Convey("Running subcommands of plugin binary", t, func() {
+		dir, err := ioutil.TempDir("", "exec-cli")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+		path := filepath.Join(dir, "setfile.json")
+		So(ioutil.WriteFile(path, mockFileContCLI, 0644), ShouldBeNil)
+
+		run := func(args ...string) (int, bool, string, string) {
+			stdout := &bytes.Buffer{}
+			stderr := &bytes.Buffer{}
+			code, ok := RunCommand("exec", args, stdout, stderr)
+			return code, ok, stdout.String(), stderr.String()
+		}
+
+		Convey("binary is started as plugin when subcommand is not given", func() {
+			_, ok, _, _ := run(`{"NoDaemon": true}`)
+			So(ok, ShouldBeFalse)
+			_, ok, _, _ = run()
+			So(ok, ShouldBeFalse)
+		})
+
+		Convey("help is printed", func() {
+			code, ok, stdout, _ := run("help")
+			So(ok, ShouldBeTrue)
+			So(code, ShouldEqual, 0)
+			So(stdout, ShouldContainSubstring, "validate")
+		})
+
+		Convey("setfile is required", func() {
+			code, ok, _, stderr := run("validate")
+			So(ok, ShouldBeTrue)
+			So(code, ShouldEqual, 2)
+			So(stderr, ShouldContainSubstring, "-setfile is required")
+		})
+
+		Convey("valid setfile is reported", func() {
+			code, _, stdout, _ := run("validate", "-setfile", path)
+			So(code, ShouldEqual, 0)
+			So(stdout, ShouldContainSubstring, "is valid, 3 metrics defined")
+		})
+
+		Convey("invalid setfile is reported", func() {
+			So(ioutil.WriteFile(path, []byte(`{"metric0": {"exec": "/bin/echo", "tpye": "string"}}`), 0644), ShouldBeNil)
+			code, _, _, stderr := run("validate", "-setfile", path)
+			So(code, ShouldEqual, 1)
+			So(stderr, ShouldContainSubstring, "unknown field tpye")
+		})
+
+		Convey("metrics are listed in order of namespaces", func() {
+			code, _, stdout, _ := run("list", "-setfile", path)
+			So(code, ShouldEqual, 0)
+			So(stdout, ShouldStartWith, "NAMESPACE")
+			So(stdout, ShouldContainSubstring, "/intel/exec/echo_float  float64  /bin/echo")
+			So(bytes.Index([]byte(stdout), []byte("echo_float")), ShouldBeLessThan, bytes.Index([]byte(stdout), []byte("echo_int")))
+		})
+
+		Convey("metrics are listed with configured namespace prefix", func() {
+			code, _, stdout, _ := run("list", "-setfile", path, "-namespace-prefix", "/acme/exec")
+			So(code, ShouldEqual, 0)
+			So(stdout, ShouldContainSubstring, "/acme/exec/echo_float")
+		})
+
+		Convey("metrics are listed as JSON", func() {
+			code, _, stdout, _ := run("list", "-setfile", path, "-output", "json")
+			So(code, ShouldEqual, 0)
+			listed := []listedMetric{}
+			So(json.Unmarshal([]byte(stdout), &listed), ShouldBeNil)
+			So(len(listed), ShouldEqual, 3)
+			So(listed[0], ShouldResemble, listedMetric{Namespace: "/intel/exec/echo_fail", Type: "int64", Exec: "/bin/echo"})
+		})
+
+		Convey("resolved definitions of metrics are shown", func() {
+			code, _, stdout, _ := run("show", "-setfile", path, "echo_int")
+			So(code, ShouldEqual, 0)
+			definitions := map[string]map[string]interface{}{}
+			So(json.Unmarshal([]byte(stdout), &definitions), ShouldBeNil)
+			So(definitions, ShouldResemble, map[string]map[string]interface{}{
+				"echo_int": {"exec": "/bin/echo", "type": "int64", "args": []interface{}{"-n", "0"}},
+			})
+		})
+
+		Convey("unsupported output format is refused", func() {
+			code, _, _, stderr := run("list", "-setfile", path, "-output", "xml")
+			So(code, ShouldEqual, 2)
+			So(stderr, ShouldContainSubstring, "unsupported output format xml")
+		})
+
+		Convey("serve reports address which cannot be used", func() {
+			code, _, _, stderr := run("serve", "-setfile", path, "-listen", "localhost:-1")
+			So(code, ShouldEqual, 1)
+			So(stderr, ShouldContainSubstring, "Error:")
+		})
+
+		Convey("collect requires --once", func() {
+			code, _, _, stderr := run("collect", "-setfile", path)
+			So(code, ShouldEqual, 2)
+			So(stderr, ShouldContainSubstring, "requires --once")
+		})
+
+		Convey("selected metrics are collected", func() {
+			code, _, stdout, _ := run("collect", "--once", "-setfile", path, "-output", "json", "echo_int", "/intel/exec/echo_float")
+			So(code, ShouldEqual, 0)
+			collected := []collectedMetric{}
+			So(json.Unmarshal([]byte(stdout), &collected), ShouldBeNil)
+			So(len(collected), ShouldEqual, 2)
+			So(collected[0].Namespace, ShouldEqual, "/intel/exec/echo_int")
+			So(collected[0].Value, ShouldEqual, 0)
+			So(collected[1].Value, ShouldEqual, 1.5)
+			So(collected[1].Error, ShouldBeEmpty)
+		})
+
+		Convey("errors of metrics are printed and change exit code", func() {
+			code, _, stdout, _ := run("collect", "--once", "-setfile", path)
+			So(code, ShouldEqual, 1)
+			So(stdout, ShouldContainSubstring, "VALUE")
+			So(stdout, ShouldContainSubstring, `Cannot parse "x" as int64`)
+		})
+
+		Convey("each key of metric with multiple values is printed", func() {
+			So(ioutil.WriteFile(path, []byte(`{"meminfo": {"exec": "/bin/echo", "type": "uint64", "format": "kv", "args": ["-e", "MemTotal: 100\\nMemFree: 40"]}}`), 0644), ShouldBeNil)
+			code, _, stdout, _ := run("collect", "--once", "-setfile", path, "-output", "json")
+			So(code, ShouldEqual, 0)
+			collected := []collectedMetric{}
+			So(json.Unmarshal([]byte(stdout), &collected), ShouldBeNil)
+			So(len(collected), ShouldEqual, 2)
+			So(collected[0].Namespace, ShouldEqual, "/intel/exec/meminfo/MemTotal")
+			So(collected[0].Value, ShouldEqual, 100)
+			So(collected[1].Namespace, ShouldEqual, "/intel/exec/meminfo/MemFree")
+			So(collected[1].Value, ShouldEqual, 40)
+		})
+
+		Convey("task config is passed to metrics", func() {
+			So(ioutil.WriteFile(path, []byte(`{"echo_port": {"exec": "/bin/echo", "type": "int64", "template": true, "args": ["-n", "{{ .Config.port }}"]}}`), 0644), ShouldBeNil)
+			code, _, stdout, _ := run("collect", "--once", "-setfile", path, "-config", "port=8080", "-output", "json")
+			So(code, ShouldEqual, 0)
+			So(stdout, ShouldContainSubstring, `"value": 8080`)
+
+			code, _, _, stderr := run("collect", "--once", "-setfile", path, "-config", "port")
+			So(code, ShouldEqual, 2)
+			So(stderr, ShouldContainSubstring, "expected key=value")
+		})
+
+		Convey("unknown metric is refused", func() {
+			code, _, _, stderr := run("collect", "--once", "-setfile", path, "echo_none")
+			So(code, ShouldEqual, 1)
+			So(stderr, ShouldContainSubstring, "metric echo_none is not defined")
+		})
+	})
+}
+
+var mockFileContCLI = []byte(`{
+	"echo_int": {"exec": "/bin/echo", "type": "int64", "args": ["-n", "0"]},
+	"echo_float": {"exec": "/bin/echo", "type": "float64", "args": ["-n", "1.5"]},
+	"echo_fail": {"exec": "/bin/echo", "type": "int64", "args": ["-n", "x"]}
+}`)
@@ -22,20 +22,20 @@ limitations under the License.
 package collector
 
 import (
-	"encoding/json"
+	"bytes"
+	"context"
 	"fmt"
-	"io/ioutil"
 	"os"
 	"os/exec"
-	"strconv"
+	"sort"
+	"strings"
 	"sync"
+	"sync/atomic"
+	"syscall"
 	"time"
 
 	log "github.com/Sirupsen/logrus"
-	"github.com/intelsdi-x/snap-plugin-utilities/config"
-	"github.com/intelsdi-x/snap/control/plugin"
-	"github.com/intelsdi-x/snap/control/plugin/cpolicy"
-	"github.com/intelsdi-x/snap/core"
+	"github.com/intelsdi-x/snap-plugin-lib-go/v1/plugin"
 	"github.com/intelsdi-x/snap/core/serror"
 	"github.com/mitchellh/mapstructure"
 )
@@ -48,13 +48,16 @@ const (
 	pluginName = "exec"
 
 	// version of plugin
-	version = 1
+	version = 2
 
-	//pluginType type of plugin
-	pluginType = plugin.CollectorPluginType
+	//PluginName name under which plugin is registered in snap
+	PluginName = pluginName
 
-	//nsLength allowed length of namespace
-	nsLength = 3
+	//PluginVersion version under which plugin is registered in snap
+	PluginVersion = version
+
+	//defaultNamespacePrefix prefix of namespaces of metrics, unless other prefix is configured
+	defaultNamespacePrefix = vendor + namespaceSeparator + pluginName
 
 	//setFileConfigVar configuration variable to define path to setfile
 	setFileConfigVar = "setfile"
@@ -62,6 +65,43 @@ const (
 	//execTimeOutConfigVar configuration variable to define max time for command/program execution
 	execTimeOutConfigVar = "execution_timeout"
 
+	//defaultExecutionTimeout default max time for command/program execution in seconds
+	defaultExecutionTimeout = 10
+
+	//setFileFormatConfigVar configuration variable to define format of setfile, by default it is based on extension of setfile
+	setFileFormatConfigVar = "setfile_format"
+
+	//strictPermissionsConfigVar configuration variable to refuse setfile and executables with insecure permissions
+	strictPermissionsConfigVar = "strict_permissions"
+
+	//namespacePrefixConfigVar configuration variable to define prefix of namespaces of metrics, e.g. /acme/exec
+	namespacePrefixConfigVar = "namespace_prefix"
+
+	//auditLogConfigVar configuration variable to define path to audit log, audit is disabled when it is not set
+	auditLogConfigVar = "audit_log"
+
+	//auditLogMaxSizeConfigVar configuration variable to define max size of audit log in megabytes before it is rotated
+	auditLogMaxSizeConfigVar = "audit_log_max_size"
+
+	//auditLogMaxBackupsConfigVar configuration variable to define number of rotated audit logs which are kept
+	auditLogMaxBackupsConfigVar = "audit_log_max_backups"
+
+	//maxConcurrencyConfigVar configuration variable to define max number of commands executed concurrently, 0 means no limit
+	maxConcurrencyConfigVar = "max_concurrency"
+
+	//allowedExecutablesConfigVar configuration variable to define executables and directories with executables
+	//which can be executed, separated by commas, all executables are allowed when it is not set
+	allowedExecutablesConfigVar = "allowed_executables"
+
+	//maxOutputSizeConfigVar configuration variable to define max size of output of command in bytes, 0 means no limit
+	maxOutputSizeConfigVar = "max_output_size"
+
+	//defaultAuditLogMaxSize default max size of audit log in megabytes
+	defaultAuditLogMaxSize = 100
+
+	//defaultAuditLogMaxBackups default number of rotated audit logs
+	defaultAuditLogMaxBackups = 5
+
 	//metricExecMapKey key in setfile to mark path to executable file
 	metricExecMapKey = "exec"
 
@@ -70,58 +110,168 @@ const (
 
 	//argsMapKey key in setfile to mark arguments needed by executable file
 	argsMapKey = "args"
+
+	//envMapKey key in setfile to mark environment variables of executable file
+	envMapKey = "env"
+
+	//stdinMapKey key in setfile to mark data written to standard input of executable file
+	stdinMapKey = "stdin"
+
+	//cwdMapKey key in setfile to mark working directory of executable file
+	cwdMapKey = "cwd"
+
+	//scriptMapKey key in setfile to mark body of script which is executed instead of executable file
+	scriptMapKey = "script"
+
+	//interpreterMapKey key in setfile to mark interpreter of script
+	interpreterMapKey = "interpreter"
+
+	//descriptionMapKey key in setfile to mark description of metric
+	descriptionMapKey = "description"
+
+	//unitMapKey key in setfile to mark unit of metric value
+	unitMapKey = "unit"
+
+	//tagsMapKey key in setfile to mark static tags added to metric
+	tagsMapKey = "tags"
+
+	//namespaceMapKey key in setfile to mark prefix of namespace of metric, which replaces configured prefix
+	namespaceMapKey = "namespace"
+
+	//configMapKey key in setfile to mark parameters of task config declared by metric
+	configMapKey = "config"
+
+	//intervalMapKey key in setfile to mark interval of collection of metric by standalone scheduler
+	intervalMapKey = "interval"
+
+	//templateMapKey key in setfile to mark that exec, interpreter, args, env and cwd of metric are Go templates
+	templateMapKey = "template"
+
+	//thousandsSeparatorMapKey key in setfile to mark separator of thousands in numbers returned by metric
+	thousandsSeparatorMapKey = "thousands_separator"
+
+	//outputMapKey key in setfile to mark steps of processing of output of metric
+	outputMapKey = "output"
+
+	//expressionMapKey key in setfile to mark expression which transforms collected value
+	expressionMapKey = "expression"
+
+	//kindMapKey key in setfile to mark kind of metric
+	kindMapKey = "kind"
+
+	//formatMapKey key in setfile to mark format of output of metric
+	formatMapKey = "format"
+
+	//redactArgsMapKey key in setfile to mark indexes of arguments which are redacted in audit log
+	redactArgsMapKey = "redact_args"
+
+	//includeMapKey key in setfile to mark other setfiles which are loaded together with it
+	includeMapKey = "include"
+
+	//defaultsMapKey key in setfile to mark settings shared by all metrics
+	defaultsMapKey = "defaults"
+
+	//templatesMapKey key in setfile to mark named settings which can be extended by metrics
+	templatesMapKey = "templates"
+
+	//extendsMapKey key in setfile to mark templates extended by metric or template
+	extendsMapKey = "extends"
+
+	//schemaMapKey key in setfile to mark JSON Schema of setfile, it is used only by editors and validators
+	schemaMapKey = "$schema"
+
+	//exitCodeField field of error returned by exeCmd which contains exit code of command
+	exitCodeField = "exitCode"
 )
 
 //Plugin exec plugin struct which gathers plugin specific data
 type Plugin struct {
-	host    string
-	metrics map[string]metric
-	cmd     exeCmd
+	host     string
+	setFile  atomic.Value
+	reloadMu sync.Mutex
+	setFiles map[setFileKey]*setFileState
+	cmd      exeCmd
+	audit    *auditLog
+	auditMu  sync.Mutex
+	scripts  *scriptCache
+	rates    *rateCache
+	limiter  *executionLimiter
 }
 
-//Meta returns meta data for plugin
-func Meta() *plugin.PluginMeta {
-	return plugin.NewPluginMeta(
-		pluginName,
-		version,
-		pluginType,
-		[]string{},
-		[]string{plugin.SnapGOBContentType},
-		plugin.ConcurrencyCount(1))
+//Meta returns options of meta data for plugin
+func Meta() []plugin.MetaOpt {
+	return []plugin.MetaOpt{
+		plugin.ConcurrencyCount(1),
+	}
 }
 
 // New creates instance of exec collector plugin
 func New() *Plugin {
-	metrics := make(map[string]metric)
 	host, err := os.Hostname()
 	if err != nil {
 		host = "localhost"
 	}
-	return &Plugin{host: host, metrics: metrics, cmd: executeCmd}
+	p := &Plugin{host: host, cmd: executeCmd, setFiles: map[setFileKey]*setFileState{}, scripts: newScriptCache(), rates: newRateCache(), limiter: newExecutionLimiter()}
+	p.setFile.Store(&setFile{metrics: map[string]metric{}})
+	return p
+}
+
+// Close removes files created by plugin, it should be called when plugin stops
+func (p *Plugin) Close() error {
+	p.auditMu.Lock()
+	if p.audit != nil {
+		p.audit.close()
+		p.audit = nil
+	}
+	p.auditMu.Unlock()
+	return p.scripts.close()
 }
 
 // GetMetricTypes returns list of available metric types
 // It returns error in case retrieval was not successful
-func (p *Plugin) GetMetricTypes(cfg plugin.ConfigType) ([]plugin.MetricType, error) {
-	mts := []plugin.MetricType{}
-	item, err := config.GetConfigItem(cfg, setFileConfigVar)
-	if err != nil {
-		return mts, err
+func (p *Plugin) GetMetricTypes(cfg plugin.Config) ([]plugin.Metric, error) {
+	mts := []plugin.Metric{}
+	setFilePath, serr := getRequiredStringConfigItem(cfg, setFileConfigVar)
+	if serr != nil {
+		return mts, serr
 	}
-	setFilePath, ok := item.(string)
-	if !ok {
-		return mts, serror.New(fmt.Errorf("Incorrect type of configuration variable, cannot parse value of %s to string", setFileConfigVar), nil)
+
+	setFileFormat, serr := getSetFileFormat(cfg)
+	if serr != nil {
+		return mts, serr
 	}
 
-	serr := p.getMetricsFromConfig(setFilePath)
+	strictPermissions, serr := getBoolConfigItem(cfg, strictPermissionsConfigVar, false)
+	if serr != nil {
+		return mts, serr
+	}
+
+	prefix, serr := getNamespacePrefix(cfg)
+	if serr != nil {
+		return mts, serr
+	}
+
+	setFile, serr := p.loadSetFile(setFilePath, setFileFormat, strictPermissions)
+	if serr != nil {
+		log.WithFields(serr.Fields()).Error(serr.Error())
+		return mts, serr
+	}
+
+	catalog, serr := setFile.catalog(prefix)
 	if serr != nil {
 		log.WithFields(serr.Fields()).Error(serr.Error())
 		return mts, serr
 	}
 
-	for mtsName := range p.metrics {
-		mts = append(mts, plugin.MetricType{
-			Namespace_: core.NewNamespace(vendor, pluginName, mtsName)})
+	for _, entry := range catalog {
+		m := setFile.metrics[entry.name]
+		mts = append(mts, plugin.Metric{
+			Namespace:   entry.namespace,
+			Version:     version,
+			Description: m.Description,
+			Unit:        m.Unit,
+			Tags:        m.tags(nil),
+		})
 	}
 
 	return mts, nil
@@ -129,154 +279,636 @@ func (p *Plugin) GetMetricTypes(cfg plugin.ConfigType) ([]plugin.MetricType, err
 
 // CollectMetrics returns list of requested metric values
 // It returns error in case retrieval was not successful
-func (p *Plugin) CollectMetrics(metrics []plugin.MetricType) ([]plugin.MetricType, error) {
-	mts := []plugin.MetricType{}
-	items, err := config.GetConfigItems(metrics[0], setFileConfigVar, execTimeOutConfigVar)
+func (p *Plugin) CollectMetrics(metrics []plugin.Metric) ([]plugin.Metric, error) {
+	mts := []plugin.Metric{}
+	results, serr := p.collect(metrics)
+	if serr != nil {
+		return mts, serr
+	}
+	for _, r := range results {
+		if r.err != nil {
+			log.WithFields(r.err.Fields()).Warn(r.err.Error())
+			continue
+		}
+		mts = append(mts, r.metrics...)
+	}
+	return mts, nil
+}
 
-	if err != nil {
-		return nil, err
+// collectResult result of collection of single metric
+type collectResult struct {
+	name     string
+	column   string
+	metrics  []plugin.Metric //values of metric, first samples of counter and derive metrics are not included
+	duration time.Duration
+	err      serror.SnapError
+}
+
+// collect executes commands of requested metrics concurrently and returns results in order of requested metrics,
+// errors which concern single metrics are returned in their results
+func (p *Plugin) collect(metrics []plugin.Metric) ([]collectResult, serror.SnapError) {
+	cfg := metrics[0].Config
+	setFilePath, serr := getRequiredStringConfigItem(cfg, setFileConfigVar)
+	if serr != nil {
+		return nil, serr
 	}
-	setFilePath, ok := items[setFileConfigVar].(string)
-	if !ok {
-		return mts, serror.New(fmt.Errorf("Incorrect type of configuration variable, cannot parse value of %s to string", setFileConfigVar), nil)
+
+	//execution timeout has default value also for metrics outside /intel/exec, to which config policy is not applied
+	defaultExecTimeout, serr := getIntConfigItem(cfg, execTimeOutConfigVar, defaultExecutionTimeout)
+	if serr != nil {
+		return nil, serr
+	}
+
+	setFileFormat, serr := getSetFileFormat(cfg)
+	if serr != nil {
+		return nil, serr
 	}
 
-	execTimeout, ok := items[execTimeOutConfigVar].(int)
-	if !ok {
-		return mts, serror.New(fmt.Errorf("Incorrect type of configuration variable, cannot parse value of %s to int", execTimeOutConfigVar), nil)
+	strictPermissions, serr := getBoolConfigItem(cfg, strictPermissionsConfigVar, false)
+	if serr != nil {
+		return nil, serr
 	}
-	execTimeoutSec := time.Second * time.Duration(execTimeout)
 
-	serr := p.getMetricsFromConfig(setFilePath)
+	prefix, serr := getNamespacePrefix(cfg)
+	if serr != nil {
+		return nil, serr
+	}
+
+	setFile, serr := p.loadSetFile(setFilePath, setFileFormat, strictPermissions)
 	if serr != nil {
 		log.WithFields(serr.Fields()).Error(serr.Error())
 		return nil, serr
 	}
 
-	var wg sync.WaitGroup
-	var mu sync.Mutex
-	wg.Add(len(metrics))
+	catalog, serr := setFile.catalog(prefix)
+	if serr != nil {
+		log.WithFields(serr.Fields()).Error(serr.Error())
+		return nil, serr
+	}
 
-	for _, m := range metrics {
+	audit, serr := p.getAuditLog(cfg)
+	if serr != nil {
+		log.WithFields(serr.Fields()).Error(serr.Error())
+		return nil, serr
+	}
+
+	limits, serr := getExecutionLimits(cfg)
+	if serr != nil {
+		log.WithFields(serr.Fields()).Error(serr.Error())
+		return nil, serr
+	}
+
+	results := make([]collectResult, len(metrics))
+	entries := make([]catalogEntry, len(metrics))
+
+	//metrics defined by the same entry of setfile and requested with the same config, e.g. columns of table,
+	//are collected from single execution of its command
+	groups := map[string][]int{}
+	order := []string{}
+	for i, m := range metrics {
+		entry, ok := lookupCatalog(catalog, m.Namespace)
+		if !ok {
+			results[i].err = serror.New(fmt.Errorf("Metric is not defined in settings file"), map[string]interface{}{"namespace": m.Namespace.String()})
+			continue
+		}
+		entries[i] = entry
+		results[i].name = entry.name
+		results[i].column = entry.column
 
-		go func(m plugin.MetricType) {
+		key := entry.name + "|" + configIdentity(m.Config)
+		if _, ok := groups[key]; !ok {
+			order = append(order, key)
+		}
+		groups[key] = append(groups[key], i)
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(len(order))
+	for _, key := range order {
+		go func(indices []int) {
 			defer wg.Done()
-			logFields := map[string]interface{}{}
+			p.collectEntry(setFile, audit, limits, defaultExecTimeout, metrics, entries, results, indices)
+		}(groups[key])
+	}
+	wg.Wait()
+	return results, nil
+}
 
-			ns := m.Namespace()
-			logFields["namespace"] = m.Namespace().String()
-			if len(ns) != nsLength {
-				serr := serror.New(fmt.Errorf("Incorrect namespace length"), logFields)
-				log.WithFields(serr.Fields()).Warn(serr.Error())
-				return
-			}
-			//get metric name, it is the last element of namespace
-			mtName := ns[nsLength-1].Value
-
-			timer := time.Now()
-			//execute command
-			cmdOut, serr := p.cmd(p.metrics[mtName].Exec, p.metrics[mtName].Args)
-			if serr != nil {
-				serr.SetFields(logFields)
-				log.WithFields(serr.Fields()).Warn(serr.Error())
+// collectEntry executes command of setfile entry once and collects all requested metrics defined by it,
+// indices select requested metrics and their results
+func (p *Plugin) collectEntry(setFile *setFile, audit *auditLog, limits executionLimits, defaultExecTimeout int, metrics []plugin.Metric, entries []catalogEntry, results []collectResult, indices []int) {
+	m := metrics[indices[0]]
+	mtName := entries[indices[0]].name
+	mtConfig := setFile.metrics[mtName]
+
+	logFields := map[string]interface{}{}
+	logFields["namespace"] = m.Namespace.String()
+	fail := func(serr serror.SnapError) {
+		for _, i := range indices {
+			results[i].err = serr
+		}
+	}
+
+	//config of task can differ between metrics
+	execTimeout, serr := getIntConfigItem(m.Config, execTimeOutConfigVar, defaultExecTimeout)
+	if serr != nil {
+		serr.SetFields(logFields)
+		fail(serr)
+		return
+	}
+	execTimeoutSec := time.Second * time.Duration(execTimeout)
+
+	taskConfig, err := mtConfig.taskConfig(m.Config)
+	if err != nil {
+		fail(serror.New(err, logFields))
+		return
+	}
+
+	cmd, secrets, err := mtConfig.command(newVariables(p.host, taskConfig), p.scripts)
+	if err != nil {
+		fail(serror.New(err, logFields))
+		return
+	}
+	if cmd.path != mtConfig.executable() {
+		//executable defined with variables is verified when its path is known
+		if execPath, err := exec.LookPath(cmd.path); err == nil {
+			if serr := verifyPermissions(execPath, setFile.strict, logFields); serr != nil {
+				fail(serr)
 				return
 			}
+		}
+	}
+	if err := checkAllowedExecutable(cmd.path, limits.allowed); err != nil {
+		fail(serror.New(err, logFields))
+		return
+	}
+	cmd.maxOutput = limits.maxOutput
+	executed := mtConfig
+	executed.Exec = cmd.path
+	//path to script file precedes arguments defined in setfile
+	executed.Args = cmd.args[len(cmd.args)-len(mtConfig.Args):]
 
-			if time.Since(timer) > execTimeoutSec {
-				//only notify that execution of command needs more time
-				serr := serror.New(fmt.Errorf("Waiting for output more than %d seconds", execTimeoutSec), logFields)
-				log.WithFields(serr.Fields()).Warn(serr.Error())
-			}
+	p.limiter.acquire(limits.concurrency)
+	timer := time.Now()
+	//execute command
+	cmdOut, serr := p.cmd(cmd)
+	duration := time.Since(timer)
+	p.limiter.release()
+	for _, i := range indices {
+		results[i].duration = duration
+	}
+	serr = scrubError(serr, secrets)
+	if audit != nil {
+		if err := audit.record(mtName, executed, cmdOut, serr, duration); err != nil {
+			log.WithFields(logFields).Errorf("Cannot write to audit log: %v", err)
+		}
+	}
+	if serr != nil {
+		serr.SetFields(logFields)
+		fail(serr)
+		return
+	}
+
+	if duration > execTimeoutSec {
+		//only notify that execution of command needs more time
+		serr := serror.New(fmt.Errorf("Waiting for output more than %v seconds", execTimeoutSec.Seconds()), logFields)
+		log.WithFields(serr.Fields()).Warn(serr.Error())
+	}
+
+	//extract value from output of command execution
+	cmdOut, err = processOutput(cmdOut, mtConfig.Output)
+	if err != nil {
+		fail(scrubError(serror.New(err, logFields), secrets))
+		return
+	}
+
+	collected := time.Now()
+	for _, i := range indices {
+		p.collectValues(&results[i], metrics[i], entries[i], mtConfig, cmdOut, secrets, collected)
+	}
+}
+
+// collectValues collects values of requested metric from processed output of its command
+func (p *Plugin) collectValues(r *collectResult, m plugin.Metric, entry catalogEntry, mtConfig metric, cmdOut []byte, secrets []string, collected time.Time) {
+	logFields := map[string]interface{}{}
+	logFields["namespace"] = m.Namespace.String()
+
+	//find values in output of command execution
+	values, err := mtConfig.parseValues(cmdOut, entry.column)
+	if err != nil {
+		r.err = scrubError(serror.New(err, logFields), secrets)
+		return
+	}
 
-			//convert output of command execution to type defined in setfile
-			data, serr := convertMetricType(cmdOut, p.metrics[mtName].Type)
-			if serr != nil {
-				serr.SetFields(logFields)
-				log.WithFields(serr.Fields()).Warn(serr.Error())
+	key := requestedKey(entry.namespace, m.Namespace)
+	found := false
+	r.metrics = []plugin.Metric{}
+	for _, v := range values {
+		if key != "" && v.key != key {
+			continue
+		}
+		found = true
+		ns := m.Namespace
+		if mtConfig.multiValue() {
+			ns = withKey(entry.namespace, v.key)
+		}
+
+		data, ok, serr := p.collectValue(mtConfig, entry.column, rateKey(ns, m.Config), v.data, collected)
+		if serr != nil {
+			serr.SetFields(logFields)
+			serr = scrubError(serr, secrets)
+			if !mtConfig.multiValue() || key != "" {
+				r.metrics = nil
+				r.err = serr
 				return
 			}
+			//values of other keys can have other types, e.g. in output of sysctl -a
+			log.WithFields(serr.Fields()).Debugf("Value of %s is skipped, %v", v.key, serr.Error())
+			continue
+		}
+		if !ok {
+			//first sample of counter, derive or delta metric
+			continue
+		}
 
-			mt := plugin.MetricType{
-				Namespace_: m.Namespace(),
-				Data_:      data,
-				Timestamp_: time.Now(),
-			}
+		r.metrics = append(r.metrics, plugin.Metric{
+			Namespace:   ns,
+			Version:     version,
+			Data:        data,
+			Timestamp:   collected,
+			Description: mtConfig.Description,
+			Unit:        mtConfig.Unit,
+			Tags:        mtConfig.tags(m.Tags),
+		})
+	}
+	if key != "" && !found {
+		r.err = serror.New(fmt.Errorf("Key %s not found in output", key), logFields)
+	}
+}
 
-			mu.Lock()
-			mts = append(mts, mt)
-			mu.Unlock()
+// collectValue converts value found in output of metric to its data type, transforms it and computes its rate,
+// false is returned for the first sample of counter, derive and delta metrics
+func (p *Plugin) collectValue(m metric, column string, sampleKey string, raw []byte, collected time.Time) (interface{}, bool, serror.SnapError) {
+	dataType := m.valueType(column)
 
-		}(m)
+	//convert value to type defined in setfile
+	data, serr := convertMetricValue(raw, dataType, m.numberFormat())
+	if serr != nil {
+		return nil, false, serr
+	}
 
+	//transform converted value
+	if expr := m.expressions[dataType]; expr != nil {
+		var err error
+		if data, err = expr.evaluate(data); err != nil {
+			return nil, false, serror.New(err)
+		}
 	}
-	wg.Wait()
-	return mts, nil
+
+	//compute rate of counter and derive metrics and change of delta metrics
+	if m.Kind == counterKind || m.Kind == deriveKind || m.Kind == deltaKind {
+		value, _ := numericValue(data)
+		rate, ok := p.rates.rate(sampleKey, m.Kind, dataType, value, collected)
+		if !ok {
+			return nil, false, nil
+		}
+		data = rate
+	}
+	return data, true, nil
 }
 
 // GetConfigPolicy returns config policy
 // It returns error in case retrieval was not successful
-func (p *Plugin) GetConfigPolicy() (*cpolicy.ConfigPolicy, error) {
-	cp := cpolicy.New()
-	config := cpolicy.NewPolicyNode()
+func (p *Plugin) GetConfigPolicy() (plugin.ConfigPolicy, error) {
+	policy := plugin.NewConfigPolicy()
+	key := []string{vendor, pluginName}
 
-	r1, err := cpolicy.NewStringRule(setFileConfigVar, true)
-	if err != nil {
-		return cp, err
+	//configuration file
+	if err := policy.AddNewStringRule(key, setFileConfigVar, true); err != nil {
+		return *policy, err
 	}
-	r1.Description = "Configuration file"
-	config.Add(r1)
 
-	r2, err := cpolicy.NewIntegerRule(execTimeOutConfigVar, false, 10)
-	if err != nil {
-		return cp, err
+	//execution timeout
+	if err := policy.AddNewIntRule(key, execTimeOutConfigVar, false, plugin.SetDefaultInt(defaultExecutionTimeout), plugin.SetMinInt(1)); err != nil {
+		return *policy, err
+	}
+
+	//format of configuration file: json, yaml or toml
+	if err := policy.AddNewStringRule(key, setFileFormatConfigVar, false); err != nil {
+		return *policy, err
+	}
+
+	//refuse setfile and executables with insecure permissions
+	if err := policy.AddNewBoolRule(key, strictPermissionsConfigVar, false, plugin.SetDefaultBool(false)); err != nil {
+		return *policy, err
+	}
+
+	//audit log file
+	if err := policy.AddNewStringRule(key, auditLogConfigVar, false); err != nil {
+		return *policy, err
+	}
+
+	//max size of audit log in megabytes
+	if err := policy.AddNewIntRule(key, auditLogMaxSizeConfigVar, false, plugin.SetDefaultInt(defaultAuditLogMaxSize), plugin.SetMinInt(1)); err != nil {
+		return *policy, err
+	}
+
+	//number of rotated audit logs
+	if err := policy.AddNewIntRule(key, auditLogMaxBackupsConfigVar, false, plugin.SetDefaultInt(defaultAuditLogMaxBackups), plugin.SetMinInt(0)); err != nil {
+		return *policy, err
+	}
+
+	//prefix of namespaces of metrics
+	if err := policy.AddNewStringRule(key, namespacePrefixConfigVar, false, plugin.SetDefaultString(defaultNamespacePrefix)); err != nil {
+		return *policy, err
+	}
+
+	//max number of commands executed concurrently
+	if err := policy.AddNewIntRule(key, maxConcurrencyConfigVar, false, plugin.SetDefaultInt(0), plugin.SetMinInt(0)); err != nil {
+		return *policy, err
+	}
+
+	//executables which can be executed
+	if err := policy.AddNewStringRule(key, allowedExecutablesConfigVar, false); err != nil {
+		return *policy, err
 	}
-	r2.Description = "Execution timeout"
-	config.Add(r2)
 
-	return cp, nil
+	//max size of output of command in bytes
+	if err := policy.AddNewIntRule(key, maxOutputSizeConfigVar, false, plugin.SetDefaultInt(0), plugin.SetMinInt(0)); err != nil {
+		return *policy, err
+	}
+
+	return *policy, nil
 }
 
-// getMetricsFromConfig extracts metrics configuration from setfile
-func (p *Plugin) getMetricsFromConfig(setFilePath string) serror.SnapError {
+// getMetricsFromConfig extracts metrics configuration from setfile, which can be a single file, a directory
+// or a glob pattern, format of setfiles is based on their extensions unless it is explicitly configured,
+// setfiles and executables with insecure permissions are refused in strict mode, otherwise only warning is logged,
+// returned snapshot contains version of read files also when loading fails
+func getMetricsFromConfig(setFilePath string, setFileFormat string, strictPermissions bool) (*setFile, serror.SnapError) {
 	logFields := map[string]interface{}{}
 	logFields["setFilePath"] = setFilePath
 
-	setFileContent, err := ioutil.ReadFile(setFilePath)
-	logFields["setFileContent"] = setFileContent
+	l := newSetFileLoader(setFilePath, setFileFormat, strictPermissions)
+	serr := l.loadPath(setFilePath, logFields)
+	if serr != nil {
+		return l.setFile, serr
+	}
+
+	names := make([]string, 0, len(l.definitions))
+	for name := range l.definitions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	//validate if structure contains necessary fields
+	metrics := map[string]metric{}
+	for _, k := range names {
+		logFields["definedIn"] = l.positions[k].String()
+		if err := validateMetricName(k); err != nil {
+			return l.setFile, serror.New(fmt.Errorf("Incorrect structure of settings file, %v at %s", err, l.positions[k]), logFields)
+		}
+		definition, err := l.resolveDefinition(k)
+		if err != nil {
+			return l.setFile, serror.New(fmt.Errorf("Incorrect structure of settings file, %v", err), logFields)
+		}
+		if err := validateMetricDefinition(k, definition, l.positions); err != nil {
+			return l.setFile, serror.New(fmt.Errorf("Incorrect structure of settings file, %v", err), logFields)
+		}
+		var m metric
+		if err := mapstructure.Decode(definition, &m); err != nil {
+			return l.setFile, serror.New(fmt.Errorf("Settings file cannot be decoded, %v", err), logFields)
+		}
+		if m.Type == "" {
+			return l.setFile, serror.New(fmt.Errorf("Incorrect structure of settings file, missing metric type for %s at %s", k, l.positions[k]), logFields)
+		}
+		if !isSupportedType(m.Type) {
+			return l.setFile, serror.New(fmt.Errorf("Incorrect structure of settings file, unsupported type %s of %s at %s, expected one of %s",
+				m.Type, k, positionOf(l.positions, []string{k, metricTypeMapKey}), strings.Join(supportedTypes, ", ")), logFields)
+		}
+		if m.Script != "" {
+			if m.Exec != "" {
+				return l.setFile, serror.New(fmt.Errorf("Incorrect structure of settings file, %s and %s cannot be used together for %s at %s",
+					metricExecMapKey, scriptMapKey, k, l.positions[k]), logFields)
+			}
+			if m.Interpreter == "" {
+				return l.setFile, serror.New(fmt.Errorf("Incorrect structure of settings file, missing metric interpreter for %s at %s", k, l.positions[k]), logFields)
+			}
+		} else {
+			if m.Interpreter != "" {
+				return l.setFile, serror.New(fmt.Errorf("Incorrect structure of settings file, %s can be used only with %s for %s at %s",
+					interpreterMapKey, scriptMapKey, k, l.positions[k]), logFields)
+			}
+			if m.Exec == "" {
+				return l.setFile, serror.New(fmt.Errorf("Incorrect structure of settings file, missing metric exec for %s at %s", k, l.positions[k]), logFields)
+			}
+		}
+		if err := validateMetricSecrets(m); err != nil {
+			return l.setFile, serror.New(fmt.Errorf("Incorrect structure of settings file, %v for %s at %s", err, k, l.positions[k]), logFields)
+		}
+		if len(m.Namespace) > 0 {
+			if err := validateNamespaceElements(m.Namespace); err != nil {
+				return l.setFile, serror.New(fmt.Errorf("Incorrect structure of settings file, %v for %s at %s",
+					err, k, positionOf(l.positions, []string{k, namespaceMapKey})), logFields)
+			}
+		}
+		if m.Interval != "" {
+			if interval, err := time.ParseDuration(m.Interval); err != nil || interval <= 0 {
+				return l.setFile, serror.New(fmt.Errorf("Incorrect structure of settings file, interval must be a positive duration like 30s or 5m, got %s for %s at %s",
+					m.Interval, k, positionOf(l.positions, []string{k, intervalMapKey})), logFields)
+			}
+		}
+		if err := validateConfigParams(m.Config); err != nil {
+			return l.setFile, serror.New(fmt.Errorf("Incorrect structure of settings file, %v for %s at %s",
+				err, k, positionOf(l.positions, []string{k, configMapKey})), logFields)
+		}
+		if err := validateMetricVariables(m); err != nil {
+			return l.setFile, serror.New(fmt.Errorf("Incorrect structure of settings file, %v for %s at %s", err, k, l.positions[k]), logFields)
+		}
+		if err := validateThousandsSeparator(m.ThousandsSeparator); err != nil {
+			return l.setFile, serror.New(fmt.Errorf("Incorrect structure of settings file, %v for %s at %s",
+				err, k, positionOf(l.positions, []string{k, thousandsSeparatorMapKey})), logFields)
+		}
+		if err := validateOutputSteps(m.Output); err != nil {
+			return l.setFile, serror.New(fmt.Errorf("Incorrect structure of settings file, %v for %s at %s",
+				err, k, positionOf(l.positions, []string{k, outputMapKey})), logFields)
+		}
+		if err := validateOutputFormat(m); err != nil {
+			return l.setFile, serror.New(fmt.Errorf("Incorrect structure of settings file, %v for %s at %s",
+				err, k, positionOf(l.positions, []string{k, formatMapKey})), logFields)
+		}
+		for _, valueType := range m.valueTypes() {
+			expr, err := compileExpression(m.Expression, valueType)
+			if err != nil {
+				return l.setFile, serror.New(fmt.Errorf("Incorrect structure of settings file, %v for %s at %s",
+					err, k, positionOf(l.positions, []string{k, expressionMapKey})), logFields)
+			}
+			if expr != nil {
+				if m.expressions == nil {
+					m.expressions = map[string]*expression{}
+				}
+				m.expressions[valueType] = expr
+			}
+			if err := validateKind(m.Kind, valueType); err != nil {
+				return l.setFile, serror.New(fmt.Errorf("Incorrect structure of settings file, %v for %s at %s",
+					err, k, positionOf(l.positions, []string{k, kindMapKey})), logFields)
+			}
+		}
+		metrics[k] = m
+	}
+
+	for k, m := range metrics {
+		execPath, err := exec.LookPath(m.executable())
+		if err != nil {
+			//executable which cannot be found is reported during collection
+			continue
+		}
+		serr := verifyPermissions(execPath, strictPermissions, map[string]interface{}{"definedIn": l.positions[k].String(), "metric": k})
+		if serr != nil {
+			return l.setFile, serr
+		}
+	}
+
+	l.setFile.metrics = metrics
+	return l.setFile, nil
+}
+
+// verifyPermissions checks permissions of file, insecure file is refused in strict mode, otherwise only warning is logged
+func verifyPermissions(path string, strict bool, logFields map[string]interface{}) serror.SnapError {
+	err := checkPermissions(path)
+	if err == nil {
+		return nil
+	}
+
+	serr := serror.New(fmt.Errorf("Insecure permissions, %v", err), logFields)
+	if strict {
+		return serr
+	}
+	log.WithFields(serr.Fields()).Warn(serr.Error())
+	return nil
+}
+
+// getAuditLog returns audit log defined in configuration or nil if audit is disabled,
+// the log is reopened only when its configuration changes
+func (p *Plugin) getAuditLog(cfg plugin.Config) (*auditLog, serror.SnapError) {
+	path, serr := getStringConfigItem(cfg, auditLogConfigVar, "")
+	if serr != nil {
+		return nil, serr
+	}
+	maxSize, serr := getIntConfigItem(cfg, auditLogMaxSizeConfigVar, defaultAuditLogMaxSize)
+	if serr != nil {
+		return nil, serr
+	}
+	maxBackups, serr := getIntConfigItem(cfg, auditLogMaxBackupsConfigVar, defaultAuditLogMaxBackups)
+	if serr != nil {
+		return nil, serr
+	}
+
+	p.auditMu.Lock()
+	defer p.auditMu.Unlock()
+
+	maxSizeBytes := int64(maxSize) * 1024 * 1024
+	if p.audit != nil {
+		if p.audit.path == path && p.audit.maxSize == maxSizeBytes && p.audit.maxBackups == maxBackups {
+			return p.audit, nil
+		}
+		p.audit.close()
+		p.audit = nil
+	}
+
+	if path == "" {
+		return nil, nil
+	}
+
+	audit, err := newAuditLog(path, maxSizeBytes, maxBackups)
 	if err != nil {
-		return serror.New(err, logFields)
+		return nil, serror.New(err, map[string]interface{}{"auditLog": path})
 	}
+	p.audit = audit
+	return audit, nil
+}
 
-	if len(setFileContent) == 0 {
-		return serror.New(fmt.Errorf("Settings file is empty"), logFields)
+// getSetFileFormat returns explicitly configured format of setfile or empty string if it is not defined
+func getSetFileFormat(cfg plugin.Config) (string, serror.SnapError) {
+	setFileFormat, serr := getStringConfigItem(cfg, setFileFormatConfigVar, "")
+	if serr != nil {
+		return "", serr
 	}
+	if err := validateSetFileFormat(setFileFormat); err != nil {
+		return "", serror.New(err, nil)
+	}
+	return setFileFormat, nil
+}
 
-	var setFileUnmarshalled map[string]interface{}
-	err = json.Unmarshal(setFileContent, &setFileUnmarshalled)
+// getRequiredStringConfigItem returns value of string configuration variable which must be defined
+func getRequiredStringConfigItem(cfg plugin.Config, name string) (string, serror.SnapError) {
+	value, err := cfg.GetString(name)
+	if err == plugin.ErrConfigNotFound {
+		return "", serror.New(fmt.Errorf("Config item %s not found", name), nil)
+	}
 	if err != nil {
-		return serror.New(fmt.Errorf("Settings file cannot be unmarshalled"), logFields)
+		return "", serror.New(fmt.Errorf("Incorrect type of configuration variable, cannot parse value of %s to string", name), nil)
 	}
+	return value, nil
+}
 
-	err = mapstructure.Decode(setFileUnmarshalled, &p.metrics)
+// getBoolConfigItem returns value of optional boolean configuration variable or default value if it is not defined
+func getBoolConfigItem(cfg plugin.Config, name string, defaultValue bool) (bool, serror.SnapError) {
+	value, err := cfg.GetBool(name)
+	if err == plugin.ErrConfigNotFound {
+		return defaultValue, nil
+	}
 	if err != nil {
-		return serror.New(fmt.Errorf("Settings file cannot be decoded"), logFields)
+		return defaultValue, serror.New(fmt.Errorf("Incorrect type of configuration variable, cannot parse value of %s to bool", name), nil)
 	}
+	return value, nil
+}
 
-	//validate if structure contains necessary fields
-	for k, m := range p.metrics {
-		if m.Type == "" {
-			return serror.New(fmt.Errorf("Incorrect structure of settings file, missing metric type for %s .", k), logFields)
-		}
-		if m.Exec == "" {
-			return serror.New(fmt.Errorf("Incorrect structure of settings file, missing metric exec for %s .", k), logFields)
-		}
+// getStringConfigItem returns value of optional string configuration variable or default value if it is not defined
+func getStringConfigItem(cfg plugin.Config, name string, defaultValue string) (string, serror.SnapError) {
+	value, err := cfg.GetString(name)
+	if err == plugin.ErrConfigNotFound {
+		return defaultValue, nil
 	}
+	if err != nil {
+		return defaultValue, serror.New(fmt.Errorf("Incorrect type of configuration variable, cannot parse value of %s to string", name), nil)
+	}
+	return value, nil
+}
 
-	return nil
+// getIntConfigItem returns value of optional integer configuration variable or default value if it is not defined
+func getIntConfigItem(cfg plugin.Config, name string, defaultValue int) (int, serror.SnapError) {
+	value, err := cfg.GetInt(name)
+	if err == plugin.ErrConfigNotFound {
+		return defaultValue, nil
+	}
+	if err != nil {
+		return defaultValue, serror.New(fmt.Errorf("Incorrect type of configuration variable, cannot parse value of %s to int", name), nil)
+	}
+	return int(value), nil
+}
+
+// supportedTypes types of metric values which can be defined in setfile
+var supportedTypes = []string{"float64", "float32", "int64", "int32", "int16", "int8", "uint64", "uint32", "uint16", "uint8", "string",
+	"bool", "duration", "bytes", "timestamp"}
+
+// isSupportedType returns true if values of metrics can be converted to the type
+func isSupportedType(dataType string) bool {
+	for _, t := range supportedTypes {
+		if t == dataType {
+			return true
+		}
+	}
+	return false
 }
 
 //convertMetricType converts metric value to type defined in setfile
 func convertMetricType(data []byte, dataType string) (interface{}, serror.SnapError) {
+	return convertMetricValue(data, dataType, numberFormat{})
+}
+
+//convertMetricValue converts metric value to type defined in setfile using given format of numbers
+func convertMetricValue(data []byte, dataType string, format numberFormat) (interface{}, serror.SnapError) {
 	var err error
 	var converted interface{}
 
@@ -284,28 +916,18 @@ func convertMetricType(data []byte, dataType string) (interface{}, serror.SnapEr
 	logFields := map[string]interface{}{"date": data, "dataType": dataType}
 
 	switch dataType {
-	case "float64":
-		converted, err = strconv.ParseFloat(dataStr, 64)
-	case "float32":
-		converted, err = strconv.ParseFloat(dataStr, 32)
-	case "int64":
-		converted, err = strconv.ParseInt(dataStr, 10, 64)
-	case "int32":
-		converted, err = strconv.ParseInt(dataStr, 10, 32)
-	case "int16":
-		converted, err = strconv.ParseInt(dataStr, 10, 16)
-	case "int8":
-		converted, err = strconv.ParseInt(dataStr, 10, 8)
-	case "uint64":
-		converted, err = strconv.ParseUint(dataStr, 10, 64)
-	case "uint32":
-		converted, err = strconv.ParseInt(dataStr, 10, 32)
-	case "uint16":
-		converted, err = strconv.ParseInt(dataStr, 10, 16)
-	case "uint8":
-		converted, err = strconv.ParseInt(dataStr, 10, 16)
+	case "float64", "float32", "int64", "int32", "int16", "int8", "uint64", "uint32", "uint16", "uint8":
+		converted, err = parseNumber(dataStr, dataType, format)
 	case "string":
 		converted = dataStr
+	case "bool":
+		converted, err = parseBool(dataStr)
+	case "duration":
+		converted, err = parseDurationSeconds(dataStr)
+	case "bytes":
+		converted, err = parseBytes(dataStr)
+	case "timestamp":
+		converted, err = parseTimestamp(dataStr)
 	default:
 		converted = dataStr
 		serr := serror.New(fmt.Errorf("Unsupported data type, metric saved as string"), logFields)
@@ -318,18 +940,201 @@ func convertMetricType(data []byte, dataType string) (interface{}, serror.SnapEr
 	return converted, nil
 }
 
-type exeCmd func(executableFilePath string, args []string) ([]byte, serror.SnapError)
+// command describes single execution of executable file
+type command struct {
+	path      string
+	args      []string
+	env       []string
+	stdin     []byte
+	dir       string
+	maxOutput int //max size of output in bytes, 0 means no limit
+}
+
+type exeCmd func(cmd command) ([]byte, serror.SnapError)
+
+func executeCmd(cmd command) ([]byte, serror.SnapError) {
+	return runCmd(context.Background(), cmd)
+}
+
+// executeCmdWithTimeout returns exeCmd which kills commands running longer than timeout
+func executeCmdWithTimeout(timeout time.Duration) exeCmd {
+	return func(cmd command) ([]byte, serror.SnapError) {
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		defer cancel()
+		return runCmd(ctx, cmd)
+	}
+}
+
+// runCmd executes command, when context is done the command and processes started by it are killed
+func runCmd(ctx context.Context, cmd command) ([]byte, serror.SnapError) {
+	c := exec.Command(cmd.path, cmd.args...)
+	c.Dir = cmd.dir
+	if len(cmd.env) > 0 {
+		c.Env = append(os.Environ(), cmd.env...)
+	}
+	if cmd.stdin != nil {
+		c.Stdin = bytes.NewReader(cmd.stdin)
+	}
+	if ctx.Done() != nil {
+		//children of command are killed together with it, otherwise they could keep its output open
+		c.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	}
+	stdout := &limitedBuffer{max: cmd.maxOutput}
+	c.Stdout = stdout
 
-func executeCmd(executableFilePath string, args []string) ([]byte, serror.SnapError) {
-	cmdOut, err := exec.Command(executableFilePath, args...).Output()
+	err := c.Start()
+	if err == nil {
+		done := make(chan error, 1)
+		go func() {
+			done <- c.Wait()
+		}()
+		select {
+		case err = <-done:
+		case <-ctx.Done():
+			syscall.Kill(-c.Process.Pid, syscall.SIGKILL)
+			<-done
+			return stdout.data, serror.New(fmt.Errorf("Command killed, it did not finish in time"), nil)
+		}
+	}
+
+	cmdOut := stdout.data
+	if err == nil && stdout.exceeded {
+		return cmdOut, serror.New(fmt.Errorf("Output of command is longer than %d bytes", cmd.maxOutput), nil)
+	}
 	if err != nil {
-		return cmdOut, serror.New(err)
+		fields := map[string]interface{}{}
+		if exitErr, ok := err.(*exec.ExitError); ok {
+			if status, ok := exitErr.Sys().(syscall.WaitStatus); ok {
+				fields[exitCodeField] = status.ExitStatus()
+			}
+		}
+		return cmdOut, serror.New(err, fields)
 	}
 	return cmdOut, nil
 }
 
 type metric struct {
-	Exec string
-	Type string
-	Args []string
+	Exec        string
+	Type        string
+	Args        []string
+	Env         map[string]string
+	Stdin       string
+	Cwd         string
+	Script      string
+	Interpreter string
+	RedactArgs  []int `mapstructure:"redact_args"`
+	Description string
+	Unit        string
+	Tags        map[string]string
+	Namespace   []string
+	Config      map[string]configParam
+	Interval    string
+	Template    bool
+
+	IntegerPrefixes    bool   `mapstructure:"integer_prefixes"`
+	ThousandsSeparator string `mapstructure:"thousands_separator"`
+	Output             []outputStep
+	Expression         string
+	Kind               string
+	Format             string
+	Separator          string
+	KeyColumn          string `mapstructure:"key_column"`
+	Columns            map[string]string
+	Header             []string
+
+	expressions map[string]*expression //parsed expression for each data type of values, set when setfile is loaded
+}
+
+// numberFormat returns options of parsing numbers in output of metric
+func (m metric) numberFormat() numberFormat {
+	return numberFormat{prefixes: m.IntegerPrefixes, separator: m.ThousandsSeparator}
+}
+
+// interval returns interval of collection of metric by standalone scheduler, by default it is given interval
+func (m metric) interval(defaultInterval time.Duration) time.Duration {
+	if interval, err := time.ParseDuration(m.Interval); err == nil {
+		return interval
+	}
+	return defaultInterval
+}
+
+// tags returns static tags of metric merged with given tags, which take precedence
+func (m metric) tags(tags map[string]string) map[string]string {
+	if len(m.Tags) == 0 && len(tags) == 0 {
+		return nil
+	}
+	merged := map[string]string{}
+	for k, v := range m.Tags {
+		merged[k] = v
+	}
+	for k, v := range tags {
+		merged[k] = v
+	}
+	return merged
+}
+
+// executable returns executable file defined in setfile, for scripts it is the interpreter
+func (m metric) executable() string {
+	if m.Script != "" {
+		return m.Interpreter
+	}
+	return m.Exec
+}
+
+// command builds command which is executed to collect metric, scripts are run by their interpreters from files
+// stored in cache, templates (if enabled) and variable references in exec, interpreter, args, env and cwd
+// and secret references in env and stdin are resolved at this point,
+// secret values are returned to allow scrubbing them from logs and errors
+func (m metric) command(vars variables, scripts *scriptCache) (command, []string, error) {
+	cmd := command{}
+	secrets := []string{}
+
+	vars.templates = m.Template
+	var err error
+	if cmd.path, _, err = vars.interpolate(m.executable(), false); err != nil {
+		return cmd, nil, err
+	}
+	if m.Script != "" {
+		scriptPath, err := scripts.path(m.Script)
+		if err != nil {
+			return cmd, nil, err
+		}
+		cmd.args = append(cmd.args, scriptPath)
+	}
+	for _, arg := range m.Args {
+		value, _, err := vars.interpolate(arg, false)
+		if err != nil {
+			return cmd, nil, err
+		}
+		cmd.args = append(cmd.args, value)
+	}
+	if cmd.dir, _, err = vars.interpolate(m.Cwd, false); err != nil {
+		return cmd, nil, err
+	}
+
+	names := make([]string, 0, len(m.Env))
+	for name := range m.Env {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		value, resolved, err := vars.interpolate(m.Env[name], true)
+		if err != nil {
+			return cmd, nil, err
+		}
+		secrets = append(secrets, resolved...)
+		cmd.env = append(cmd.env, name+"="+value)
+	}
+
+	if m.Stdin != "" {
+		value, resolved, err := resolveSecrets(m.Stdin)
+		if err != nil {
+			return cmd, nil, err
+		}
+		secrets = append(secrets, resolved...)
+		cmd.stdin = []byte(value)
+	}
+
+	return cmd, secrets, nil
 }
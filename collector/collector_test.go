@@ -27,10 +27,7 @@ import (
 	"testing"
 	"time"
 
-	"github.com/intelsdi-x/snap/control/plugin"
-	"github.com/intelsdi-x/snap/core"
-	"github.com/intelsdi-x/snap/core/cdata"
-	"github.com/intelsdi-x/snap/core/ctypes"
+	"github.com/intelsdi-x/snap-plugin-lib-go/v1/plugin"
 	"github.com/intelsdi-x/snap/core/serror"
 	. "github.com/smartystreets/goconvey/convey"
 )
@@ -38,9 +35,9 @@ import (
 func TestMeta(t *testing.T) {
 	Convey("Calling Meta function", t, func() {
 		meta := Meta()
-		So(meta.Name, ShouldResemble, pluginName)
-		So(meta.Version, ShouldResemble, version)
-		So(meta.Type, ShouldResemble, plugin.CollectorPluginType)
+		So(meta, ShouldNotBeEmpty)
+		So(PluginName, ShouldEqual, pluginName)
+		So(PluginVersion, ShouldEqual, version)
 	})
 }
 
@@ -49,7 +46,7 @@ func TestNew(t *testing.T) {
 		plugin := New()
 		So(plugin, ShouldNotBeNil)
 		So(plugin.host, ShouldNotBeNil)
-		So(plugin.metrics, ShouldNotBeNil)
+		So(plugin.currentSetFile().metrics, ShouldNotBeNil)
 	})
 }
 
@@ -68,7 +65,7 @@ func TestGetMetricTypes(t *testing.T) {
 	Convey("Getting exposed metric types", t, func() {
 
 		Convey("when no configuration item available", func() {
-			cfg := plugin.NewPluginConfigType()
+			cfg := plugin.Config{}
 			plugin := New()
 			So(func() { plugin.GetMetricTypes(cfg) }, ShouldNotPanic)
 			mts, err := plugin.GetMetricTypes(cfg)
@@ -82,8 +79,8 @@ func TestGetMetricTypes(t *testing.T) {
 			deleteMockFile()
 
 			//create configuration
-			config := plugin.NewPluginConfigType()
-			config.AddItem(setFileConfigVar, ctypes.ConfigValueStr{Value: mockFilePath})
+			config := plugin.Config{}
+			config[setFileConfigVar] = mockFilePath
 
 			So(func() { plg.GetMetricTypes(config) }, ShouldNotPanic)
 			mts, err := plg.GetMetricTypes(config)
@@ -98,8 +95,8 @@ func TestGetMetricTypes(t *testing.T) {
 			createMockFile(mockFileContEmpty)
 			defer deleteMockFile()
 
-			config := plugin.NewPluginConfigType()
-			config.AddItem(setFileConfigVar, ctypes.ConfigValueStr{Value: mockFilePath})
+			config := plugin.Config{}
+			config[setFileConfigVar] = mockFilePath
 
 			So(func() { plg.GetMetricTypes(config) }, ShouldNotPanic)
 			mts, err := plg.GetMetricTypes(config)
@@ -112,8 +109,8 @@ func TestGetMetricTypes(t *testing.T) {
 			createMockFile(mockFileCont)
 			defer deleteMockFile()
 
-			config := plugin.NewPluginConfigType()
-			config.AddItem("setfile", ctypes.ConfigValueStr{Value: mockFilePath})
+			config := plugin.Config{}
+			config["setfile"] = mockFilePath
 
 			So(func() { plg.GetMetricTypes(config) }, ShouldNotPanic)
 			mts, err := plg.GetMetricTypes(config)
@@ -132,10 +129,10 @@ func TestCollectMetrics(t *testing.T) {
 
 		Convey("when no configuration settings available", func() {
 			// set metrics config
-			config := cdata.NewNode()
+			config := plugin.Config{}
 			mts := mockMts
 			for i := range mts {
-				mts[i].Config_ = config
+				mts[i].Config = config
 			}
 
 			plg := New()
@@ -147,11 +144,11 @@ func TestCollectMetrics(t *testing.T) {
 
 		Convey("when execution timout configuration variable is not available", func() {
 			// set metrics config
-			config := cdata.NewNode()
-			config.AddItem(setFileConfigVar, ctypes.ConfigValueStr{Value: mockFilePath})
+			config := plugin.Config{}
+			config[setFileConfigVar] = mockFilePath
 			mts := mockMts
 			for i := range mts {
-				mts[i].Config_ = config
+				mts[i].Config = config
 			}
 
 			plg := New()
@@ -163,12 +160,12 @@ func TestCollectMetrics(t *testing.T) {
 
 		Convey("when execution timout configuration variable has incorrect type", func() {
 			// set metrics config
-			config := cdata.NewNode()
-			config.AddItem(setFileConfigVar, ctypes.ConfigValueStr{Value: mockFilePath})
-			config.AddItem(execTimeOutConfigVar, ctypes.ConfigValueStr{Value: "1"})
+			config := plugin.Config{}
+			config[setFileConfigVar] = mockFilePath
+			config[execTimeOutConfigVar] = "1"
 			mts := mockMts
 			for i := range mts {
-				mts[i].Config_ = config
+				mts[i].Config = config
 			}
 
 			plg := New()
@@ -180,12 +177,12 @@ func TestCollectMetrics(t *testing.T) {
 
 		Convey("when setfile configuration variable has incorrect type", func() {
 			// set metrics config
-			config := cdata.NewNode()
-			config.AddItem(setFileConfigVar, ctypes.ConfigValueInt{Value: 1})
-			config.AddItem(execTimeOutConfigVar, ctypes.ConfigValueInt{Value: 1})
+			config := plugin.Config{}
+			config[setFileConfigVar] = int64(1)
+			config[execTimeOutConfigVar] = int64(1)
 			mts := mockMts
 			for i := range mts {
-				mts[i].Config_ = config
+				mts[i].Config = config
 			}
 
 			plg := New()
@@ -197,12 +194,12 @@ func TestCollectMetrics(t *testing.T) {
 
 		Convey("when configuration is invalid", func() {
 			//set metrics config
-			config := cdata.NewNode()
-			config.AddItem(setFileConfigVar, ctypes.ConfigValueStr{Value: mockFilePath})
-			config.AddItem(execTimeOutConfigVar, ctypes.ConfigValueInt{Value: 1})
+			config := plugin.Config{}
+			config[setFileConfigVar] = mockFilePath
+			config[execTimeOutConfigVar] = int64(1)
 			mts := mockMts
 			for i := range mts {
-				mts[i].Config_ = config
+				mts[i].Config = config
 			}
 
 			Convey("incorrect path to setfile", func() {
@@ -235,12 +232,12 @@ func TestCollectMetrics(t *testing.T) {
 			defer deleteMockFile()
 
 			//set metrics config
-			config := cdata.NewNode()
-			config.AddItem(setFileConfigVar, ctypes.ConfigValueStr{Value: mockFilePath})
-			config.AddItem(execTimeOutConfigVar, ctypes.ConfigValueInt{Value: 1})
+			config := plugin.Config{}
+			config[setFileConfigVar] = mockFilePath
+			config[execTimeOutConfigVar] = int64(1)
 			mts := mockMts
 			for i := range mts {
-				mts[i].Config_ = config
+				mts[i].Config = config
 			}
 
 			plg := New()
@@ -256,12 +253,12 @@ func TestCollectMetrics(t *testing.T) {
 			defer deleteMockFile()
 
 			//set metrics config
-			config := cdata.NewNode()
-			config.AddItem(setFileConfigVar, ctypes.ConfigValueStr{Value: mockFilePath})
-			config.AddItem(execTimeOutConfigVar, ctypes.ConfigValueInt{Value: 1})
+			config := plugin.Config{}
+			config[setFileConfigVar] = mockFilePath
+			config[execTimeOutConfigVar] = int64(1)
 			mts := mockMts
 			for i := range mts {
-				mts[i].Config_ = config
+				mts[i].Config = config
 			}
 
 			plg := New()
@@ -277,12 +274,12 @@ func TestCollectMetrics(t *testing.T) {
 			defer deleteMockFile()
 
 			//set metrics config
-			config := cdata.NewNode()
-			config.AddItem(setFileConfigVar, ctypes.ConfigValueStr{Value: mockFilePath})
-			config.AddItem(execTimeOutConfigVar, ctypes.ConfigValueInt{Value: 1})
+			config := plugin.Config{}
+			config[setFileConfigVar] = mockFilePath
+			config[execTimeOutConfigVar] = int64(1)
 			mts := mockMts
 			for i := range mts {
-				mts[i].Config_ = config
+				mts[i].Config = config
 			}
 
 			plg := New()
@@ -298,12 +295,12 @@ func TestCollectMetrics(t *testing.T) {
 			defer deleteMockFile()
 
 			//set metrics config
-			config := cdata.NewNode()
-			config.AddItem(setFileConfigVar, ctypes.ConfigValueStr{Value: mockFilePath})
-			config.AddItem(execTimeOutConfigVar, ctypes.ConfigValueInt{Value: 1})
+			config := plugin.Config{}
+			config[setFileConfigVar] = mockFilePath
+			config[execTimeOutConfigVar] = int64(1)
 			mts := mockMts
 			for i := range mts {
-				mts[i].Config_ = config
+				mts[i].Config = config
 			}
 
 			plg := New()
@@ -313,18 +310,78 @@ func TestCollectMetrics(t *testing.T) {
 			So(err, ShouldBeNil)
 		})
 
+		Convey("collect metrics with secrets", func() {
+			//create setfile
+			createMockFile(mockFileContSecrets)
+			defer deleteMockFile()
+			os.Setenv("EXEC_TEST_SECRET", "t0ken")
+			defer os.Unsetenv("EXEC_TEST_SECRET")
+
+			//set metrics config
+			config := plugin.Config{}
+			config[setFileConfigVar] = mockFilePath
+			config[execTimeOutConfigVar] = int64(1)
+			mts := []plugin.Metric{
+				plugin.Metric{Namespace: plugin.NewNamespace(vendor, pluginName, "metric0"), Config: config},
+			}
+
+			var executed command
+			plg := New()
+			plg.cmd = func(cmd command) ([]byte, serror.SnapError) {
+				executed = cmd
+				return []byte("65"), nil
+			}
+			results, err := plg.CollectMetrics(mts)
+			So(err, ShouldBeNil)
+			So(len(results), ShouldEqual, 1)
+
+			Convey("Then secrets are passed via environment and stdin", func() {
+				So(executed.args, ShouldResemble, []string{"-c", "echo 65"})
+				So(executed.env, ShouldResemble, []string{"PASS=t0ken"})
+				So(string(executed.stdin), ShouldEqual, "t0ken")
+			})
+		})
+
+		Convey("collect metrics with audit log", func() {
+			//create setfile
+			createMockFile(mockFileCont)
+			defer deleteMockFile()
+			defer os.Remove(mockAuditLogPath)
+
+			//set metrics config
+			config := plugin.Config{}
+			config[setFileConfigVar] = mockFilePath
+			config[execTimeOutConfigVar] = int64(1)
+			config[auditLogConfigVar] = mockAuditLogPath
+			mts := mockMts
+			for i := range mts {
+				mts[i].Config = config
+			}
+
+			plg := New()
+			plg.cmd = mockExecuteCmd
+			results, err := plg.CollectMetrics(mts)
+			So(err, ShouldBeNil)
+			So(len(results), ShouldEqual, len(mts))
+			plg.audit.close()
+
+			Convey("Then every execution is recorded", func() {
+				So(len(readAuditRecords(mockAuditLogPath)), ShouldEqual, len(mts))
+			})
+		})
+
 		Convey("collect metrics successfully", func() {
 			//create setfile
 			createMockFile(mockFileCont)
 			defer deleteMockFile()
 
 			//set metrics config
-			config := cdata.NewNode()
-			config.AddItem(setFileConfigVar, ctypes.ConfigValueStr{Value: mockFilePath})
-			config.AddItem(execTimeOutConfigVar, ctypes.ConfigValueInt{Value: 1})
+			config := plugin.Config{}
+			config[setFileConfigVar] = mockFilePath
+			config[execTimeOutConfigVar] = int64(1)
 			mts := mockMts
 			for i := range mts {
-				mts[i].Config_ = config
+				mts[i].Config = config
 			}
 
 			plg := New()
@@ -337,7 +394,7 @@ func TestCollectMetrics(t *testing.T) {
 			Convey("Then proper metrics values are returned", func() {
 				So(len(results), ShouldEqual, len(mts))
 				for _, mt := range results {
-					So(mt.Data_, ShouldNotBeNil)
+					So(mt.Data, ShouldNotBeNil)
 				}
 			})
 		})
@@ -348,16 +405,14 @@ func TestGetMetricsFromConfig(t *testing.T) {
 	Convey("Calling getMetricsFromConfig function", t, func() {
 
 		Convey("Calling getMetricsFromConfig without setfile configuration variable", func() {
-			plg := New()
-			serr := plg.getMetricsFromConfig(mockFilePath)
+			_, serr := getMetricsFromConfig(mockFilePath, "", false)
 			So(serr, ShouldNotBeNil)
 		})
 
 		Convey("Calling getMetricsFromConfig with incorrect path to setfile", func() {
 			deleteMockFile()
 
-			plg := New()
-			serr := plg.getMetricsFromConfig(mockFilePath)
+			_, serr := getMetricsFromConfig(mockFilePath, "", false)
 			So(serr, ShouldNotBeNil)
 		})
 
@@ -365,8 +420,7 @@ func TestGetMetricsFromConfig(t *testing.T) {
 			createMockFile(mockFileContEmpty)
 			defer deleteMockFile()
 
-			plg := New()
-			serr := plg.getMetricsFromConfig(mockFilePath)
+			_, serr := getMetricsFromConfig(mockFilePath, "", false)
 			So(serr, ShouldNotBeNil)
 		})
 
@@ -374,8 +428,7 @@ func TestGetMetricsFromConfig(t *testing.T) {
 			createMockFile(mockFileContStructErr)
 			defer deleteMockFile()
 
-			plg := New()
-			serr := plg.getMetricsFromConfig(mockFilePath)
+			_, serr := getMetricsFromConfig(mockFilePath, "", false)
 			So(serr, ShouldNotBeNil)
 		})
 
@@ -383,8 +436,7 @@ func TestGetMetricsFromConfig(t *testing.T) {
 			createMockFile(mockFileContMapErr)
 			defer deleteMockFile()
 
-			plg := New()
-			serr := plg.getMetricsFromConfig(mockFilePath)
+			_, serr := getMetricsFromConfig(mockFilePath, "", false)
 			So(serr, ShouldNotBeNil)
 		})
 
@@ -392,8 +444,7 @@ func TestGetMetricsFromConfig(t *testing.T) {
 			createMockFile(mockFileContMissingType)
 			defer deleteMockFile()
 
-			plg := New()
-			serr := plg.getMetricsFromConfig(mockFilePath)
+			_, serr := getMetricsFromConfig(mockFilePath, "", false)
 			So(serr, ShouldNotBeNil)
 		})
 
@@ -401,8 +452,15 @@ func TestGetMetricsFromConfig(t *testing.T) {
 			createMockFile(mockFileContMissingExec)
 			defer deleteMockFile()
 
-			plg := New()
-			serr := plg.getMetricsFromConfig(mockFilePath)
+			_, serr := getMetricsFromConfig(mockFilePath, "", false)
+			So(serr, ShouldNotBeNil)
+		})
+
+		Convey("Calling getMetricsFromConfig with secret reference in args", func() {
+			createMockFile(mockFileContSecretInArgs)
+			defer deleteMockFile()
+
+			_, serr := getMetricsFromConfig(mockFilePath, "", false)
 			So(serr, ShouldNotBeNil)
 		})
 
@@ -410,11 +468,72 @@ func TestGetMetricsFromConfig(t *testing.T) {
 			createMockFile(mockFileCont)
 			defer deleteMockFile()
 
-			plg := New()
-			serr := plg.getMetricsFromConfig(mockFilePath)
+			_, serr := getMetricsFromConfig(mockFilePath, "", false)
 			So(serr, ShouldBeNil)
 		})
 
+		Convey("Calling getMetricsFromConfig with world-writable setfile", func() {
+			createMockFile(mockFileCont)
+			defer deleteMockFile()
+			os.Chmod(mockFilePath, 0666)
+
+			Convey("in strict mode setfile is refused", func() {
+				_, serr := getMetricsFromConfig(mockFilePath, "", true)
+				So(serr, ShouldNotBeNil)
+			})
+
+			Convey("in non-strict mode setfile is loaded", func() {
+				_, serr := getMetricsFromConfig(mockFilePath, "", false)
+				So(serr, ShouldBeNil)
+			})
+		})
+
+	})
+}
+
+func TestMetricMetadata(t *testing.T) {
+	Convey("Metadata of metrics", t, func() {
+		createMockFile(mockFileContMetadata)
+		defer deleteMockFile()
+
+		config := plugin.Config{}
+		config[setFileConfigVar] = mockFilePath
+		config[execTimeOutConfigVar] = int64(10)
+
+		plg := New()
+		plg.cmd = mockExecuteCmd
+
+		Convey("are returned by GetMetricTypes", func() {
+			mts, err := plg.GetMetricTypes(config)
+			So(err, ShouldBeNil)
+			So(len(mts), ShouldEqual, 2)
+			for _, mt := range mts {
+				switch mt.Namespace.String() {
+				case "/intel/exec/memory":
+					So(mt.Description, ShouldEqual, "Used memory")
+					So(mt.Unit, ShouldEqual, "B")
+					So(mt.Tags, ShouldResemble, map[string]string{"team": "infra"})
+				default:
+					So(mt.Description, ShouldBeEmpty)
+					So(mt.Unit, ShouldBeEmpty)
+					So(mt.Tags, ShouldBeNil)
+				}
+			}
+		})
+
+		Convey("are returned by CollectMetrics with tags of task", func() {
+			mts := []plugin.Metric{{
+				Namespace: plugin.NewNamespace(vendor, pluginName, "memory"),
+				Config:    config,
+				Tags:      map[string]string{"team": "web", "env": "prod"},
+			}}
+			results, err := plg.CollectMetrics(mts)
+			So(err, ShouldBeNil)
+			So(len(results), ShouldEqual, 1)
+			So(results[0].Description, ShouldEqual, "Used memory")
+			So(results[0].Unit, ShouldEqual, "B")
+			So(results[0].Tags, ShouldResemble, map[string]string{"team": "web", "env": "prod"})
+		})
 	})
 }
 
@@ -500,34 +619,50 @@ func deleteMockFile() {
 	os.Remove(mockFilePath)
 }
 
-func mockExecuteCmd(executableFilePath string, args []string) ([]byte, serror.SnapError) {
+func mockExecuteCmd(cmd command) ([]byte, serror.SnapError) {
 	return []byte("65"), nil
 }
 
-func mockExecuteCmdErr(executableFilePath string, args []string) ([]byte, serror.SnapError) {
+func mockExecuteCmdErr(cmd command) ([]byte, serror.SnapError) {
 	return []byte("65"), serror.New(fmt.Errorf("Error"))
 }
 
-func mockExecuteCmdTypeErr(executableFilePath string, args []string) ([]byte, serror.SnapError) {
+func mockExecuteCmdTypeErr(cmd command) ([]byte, serror.SnapError) {
 	return []byte("test"), nil
 }
 
-func mockExecuteCmdWithTimeout(executableFilePath string, args []string) ([]byte, serror.SnapError) {
+func mockExecuteCmdWithTimeout(cmd command) ([]byte, serror.SnapError) {
 	time.Sleep(2 * time.Second)
 	return []byte("test"), nil
 }
 
 var (
-	mockMts = []plugin.MetricType{
-		plugin.MetricType{Namespace_: core.NewNamespace(vendor, pluginName, "metric4")},
-		plugin.MetricType{Namespace_: core.NewNamespace(vendor, pluginName, "metric3")},
-		plugin.MetricType{Namespace_: core.NewNamespace(vendor, pluginName, "metric2")},
-		plugin.MetricType{Namespace_: core.NewNamespace(vendor, pluginName, "metric1")},
-		plugin.MetricType{Namespace_: core.NewNamespace(vendor, pluginName, "metric0")},
+	mockMts = []plugin.Metric{
+		plugin.Metric{Namespace: plugin.NewNamespace(vendor, pluginName, "metric4")},
+		plugin.Metric{Namespace: plugin.NewNamespace(vendor, pluginName, "metric3")},
+		plugin.Metric{Namespace: plugin.NewNamespace(vendor, pluginName, "metric2")},
+		plugin.Metric{Namespace: plugin.NewNamespace(vendor, pluginName, "metric1")},
+		plugin.Metric{Namespace: plugin.NewNamespace(vendor, pluginName, "metric0")},
 	}
 
 	mockFilePath = "./temp_setfile.json"
 
+	mockAuditLogPath = "./temp_audit.log"
+
+	mockFileContMetadata = []byte(`{
+		"memory": {
+			"exec": "/bin/echo",
+			"type": "int64",
+			"description": "Used memory",
+			"unit": "B",
+			"tags": {"team": "infra"}
+		},
+		"plain": {
+			"exec": "/bin/echo",
+			"type": "int64"
+		}
+	}`)
+
 	mockFileCont = []byte(`{
 		 "metric0": {
 				"exec": "/bin/sh",
@@ -649,6 +784,26 @@ var (
 	}
 	`)
 
+	mockFileContSecrets = []byte(`{
+		 "metric0": {
+				"exec": "/bin/sh",
+				"type": "int64",
+				"args": ["-c", "echo 65"],
+				"env": {"PASS": "${secret:env:EXEC_TEST_SECRET}"},
+				"stdin": "${secret:env:EXEC_TEST_SECRET}"
+		}
+	}
+	`)
+
+	mockFileContSecretInArgs = []byte(`{
+		 "metric0": {
+				"exec": "/bin/sh",
+				"type": "int64",
+				"args": ["-c", "echo ${secret:env:EXEC_TEST_SECRET}"]
+		}
+	}
+	`)
+
 	mockFileContExecError = []byte(`{
 		 "metric0": {
 				"exec": "test1234",
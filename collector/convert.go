@@ -0,0 +1,222 @@
+// +build linux
+
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+
+Copyright 2016 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package collector
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// numberFormat options of parsing numbers in output of metric
+type numberFormat struct {
+	prefixes  bool   //integers can be given with 0x, 0o, 0b or 0 prefix
+	separator string //separator of thousands which is removed from numbers
+}
+
+// bitSizes sizes of numeric data types
+var bitSizes = map[string]int{
+	"float64": 64, "float32": 32,
+	"int64": 64, "int32": 32, "int16": 16, "int8": 8,
+	"uint64": 64, "uint32": 32, "uint16": 16, "uint8": 8,
+}
+
+// byteUnits multipliers of byte-size suffixes, single letters and IEC suffixes are powers of 1024 as in output of du or free,
+// SI suffixes with B are powers of 1000
+var byteUnits = map[string]float64{
+	"":    1,
+	"b":   1,
+	"k":   1 << 10,
+	"m":   1 << 20,
+	"g":   1 << 30,
+	"t":   1 << 40,
+	"p":   1 << 50,
+	"ki":  1 << 10,
+	"mi":  1 << 20,
+	"gi":  1 << 30,
+	"ti":  1 << 40,
+	"pi":  1 << 50,
+	"kib": 1 << 10,
+	"mib": 1 << 20,
+	"gib": 1 << 30,
+	"tib": 1 << 40,
+	"pib": 1 << 50,
+	"kb":  1e3,
+	"mb":  1e6,
+	"gb":  1e9,
+	"tb":  1e12,
+	"pb":  1e15,
+}
+
+// validateThousandsSeparator checks that separator of thousands is a single character which is not part of numbers
+func validateThousandsSeparator(separator string) error {
+	if separator == "" {
+		return nil
+	}
+	if utf8.RuneCountInString(separator) != 1 || strings.ContainsAny(separator, "0123456789abcdefABCDEF.+-xXoO") {
+		return fmt.Errorf("thousands_separator must be a single character which is not a digit, sign or decimal point, got %q", separator)
+	}
+	return nil
+}
+
+// parseNumber converts s to numeric data type, the result has Go type of data type, except 8 and 16-bit integers,
+// which are checked against range of data type and returned as int32 or uint32, the smallest integers snap accepts
+func parseNumber(s string, dataType string, format numberFormat) (interface{}, error) {
+	if format.separator != "" {
+		s = strings.Replace(s, format.separator, "", -1)
+	}
+	bitSize := bitSizes[dataType]
+
+	var err error
+	switch {
+	case strings.HasPrefix(dataType, "float"):
+		var v float64
+		if v, err = strconv.ParseFloat(s, bitSize); err == nil {
+			if bitSize == 32 {
+				return float32(v), nil
+			}
+			return v, nil
+		}
+	case strings.HasPrefix(dataType, "uint"):
+		var v uint64
+		if v, err = parseUint(s, bitSize, format.prefixes); err == nil {
+			if bitSize < 64 {
+				return uint32(v), nil
+			}
+			return v, nil
+		}
+	default:
+		var v int64
+		if v, err = parseInt(s, bitSize, format.prefixes); err == nil {
+			if bitSize < 64 {
+				return int32(v), nil
+			}
+			return v, nil
+		}
+	}
+
+	if numErr, ok := err.(*strconv.NumError); ok && numErr.Err == strconv.ErrRange {
+		return nil, fmt.Errorf("Value %q is out of range of %s", s, dataType)
+	}
+	return nil, fmt.Errorf("Cannot parse %q as %s", s, dataType)
+}
+
+// parseInt parses signed integer, with prefixes enabled base of integer is defined by its prefix
+func parseInt(s string, bitSize int, prefixes bool) (int64, error) {
+	if !prefixes {
+		return strconv.ParseInt(s, 10, bitSize)
+	}
+	sign := ""
+	if strings.HasPrefix(s, "-") || strings.HasPrefix(s, "+") {
+		sign, s = s[:1], s[1:]
+	}
+	digits, base := integerBase(s)
+	return strconv.ParseInt(sign+digits, base, bitSize)
+}
+
+// parseUint parses unsigned integer, with prefixes enabled base of integer is defined by its prefix
+func parseUint(s string, bitSize int, prefixes bool) (uint64, error) {
+	if !prefixes {
+		return strconv.ParseUint(s, 10, bitSize)
+	}
+	digits, base := integerBase(s)
+	return strconv.ParseUint(digits, base, bitSize)
+}
+
+// integerBase returns digits of integer and its base defined by prefix: 0x - hexadecimal, 0o or 0 - octal, 0b - binary
+func integerBase(s string) (string, int) {
+	digits, base := s, 10
+	lower := strings.ToLower(s)
+	switch {
+	case strings.HasPrefix(lower, "0x"):
+		digits, base = s[2:], 16
+	case strings.HasPrefix(lower, "0o"):
+		digits, base = s[2:], 8
+	case strings.HasPrefix(lower, "0b"):
+		digits, base = s[2:], 2
+	case len(s) > 1 && s[0] == '0':
+		digits, base = s[1:], 8
+	}
+	if base != 10 && (strings.HasPrefix(digits, "-") || strings.HasPrefix(digits, "+")) {
+		//sign is allowed only before prefix
+		return s, 10
+	}
+	return digits, base
+}
+
+// parseBool converts true/false, yes/no or 1/0 to 1 or 0
+func parseBool(s string) (int64, error) {
+	switch strings.ToLower(s) {
+	case "true", "yes", "1":
+		return 1, nil
+	case "false", "no", "0":
+		return 0, nil
+	}
+	return 0, fmt.Errorf("Cannot parse %q as bool, expected true, false, yes, no, 1 or 0", s)
+}
+
+// parseDurationSeconds converts duration like 1h2m or 150ms to seconds, numbers without unit are seconds
+func parseDurationSeconds(s string) (float64, error) {
+	if seconds, err := strconv.ParseFloat(s, 64); err == nil {
+		return seconds, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, fmt.Errorf("Cannot parse %q as duration, expected value like 1h2m or 150ms", s)
+	}
+	return d.Seconds(), nil
+}
+
+// parseBytes converts size like 1.5G or 200KiB to number of bytes rounded to integer
+func parseBytes(s string) (uint64, error) {
+	i := strings.IndexFunc(s, func(r rune) bool {
+		return (r < '0' || r > '9') && r != '.'
+	})
+	if i < 0 {
+		i = len(s)
+	}
+	number, err := strconv.ParseFloat(s[:i], 64)
+	multiplier, ok := byteUnits[strings.ToLower(strings.TrimSpace(s[i:]))]
+	if err != nil || !ok {
+		return 0, fmt.Errorf("Cannot parse %q as size, expected value like 1.5G, 200KiB or 10MB", s)
+	}
+	bytes := math.Floor(number*multiplier + 0.5)
+	if bytes >= math.MaxUint64 {
+		return 0, fmt.Errorf("Size %q is out of range", s)
+	}
+	return uint64(bytes), nil
+}
+
+// parseTimestamp converts RFC3339 time or Unix time in seconds to Unix time in seconds
+func parseTimestamp(s string) (float64, error) {
+	if seconds, err := strconv.ParseFloat(s, 64); err == nil {
+		return seconds, nil
+	}
+	t, err := time.Parse(time.RFC3339Nano, s)
+	if err != nil {
+		return 0, fmt.Errorf("Cannot parse %q as timestamp, expected RFC3339 time or Unix time in seconds", s)
+	}
+	return float64(t.UnixNano()) / 1e9, nil
+}
@@ -0,0 +1,226 @@
+// +build linux
+
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+
+Copyright 2016 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package collector
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/intelsdi-x/snap-plugin-lib-go/v1/plugin"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestConvertHumanReadableTypes(t *testing.T) {
+	Convey("Converting human-readable outputs to numbers", t, func() {
+		Convey("bool", func() {
+			for s, expected := range map[string]int64{"true": 1, "Yes": 1, "1": 1, "FALSE": 0, "no": 0, "0": 0} {
+				v, err := convertMetricType([]byte(s), "bool")
+				So(err, ShouldBeNil)
+				So(v, ShouldEqual, expected)
+			}
+			_, err := convertMetricType([]byte("maybe"), "bool")
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("duration", func() {
+			for s, expected := range map[string]float64{"1h2m": 3720, "150ms": 0.15, "2.5": 2.5, "-1s": -1} {
+				v, err := convertMetricType([]byte(s), "duration")
+				So(err, ShouldBeNil)
+				So(v, ShouldAlmostEqual, expected)
+			}
+			_, err := convertMetricType([]byte("3 days"), "duration")
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("bytes", func() {
+			for s, expected := range map[string]uint64{
+				"512":    512,
+				"512B":   512,
+				"1.5G":   1610612736,
+				"200KiB": 204800,
+				"200Ki":  204800,
+				"10MB":   10000000,
+				"1kb":    1000,
+				"2 T":    2 << 40,
+			} {
+				v, err := convertMetricType([]byte(s), "bytes")
+				So(err, ShouldBeNil)
+				So(v, ShouldEqual, expected)
+			}
+			for _, s := range []string{"", "G", "1.5X", "-1K", "1e40P"} {
+				_, err := convertMetricType([]byte(s), "bytes")
+				So(err, ShouldNotBeNil)
+			}
+		})
+
+		Convey("timestamp", func() {
+			for s, expected := range map[string]float64{
+				"2017-01-02T15:04:05Z":        1483369445,
+				"2017-01-02T16:04:05.5+01:00": 1483369445.5,
+				"1483369445":                  1483369445,
+				"1483369445.25":               1483369445.25,
+			} {
+				v, err := convertMetricType([]byte(s), "timestamp")
+				So(err, ShouldBeNil)
+				So(v, ShouldAlmostEqual, expected, 1e-6)
+			}
+			_, err := convertMetricType([]byte("yesterday"), "timestamp")
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
+
+func TestParseNumbers(t *testing.T) {
+	Convey("Parsing numbers returned by metrics", t, func() {
+		Convey("values have Go types of declared data types, 8 and 16-bit integers are widened to 32 bits", func() {
+			for dataType, expected := range map[string]interface{}{
+				"float64": float64(42), "float32": float32(42),
+				"int64": int64(42), "int32": int32(42), "int16": int32(42), "int8": int32(42),
+				"uint64": uint64(42), "uint32": uint32(42), "uint16": uint32(42), "uint8": uint32(42),
+			} {
+				v, err := convertMetricType([]byte("42"), dataType)
+				So(err, ShouldBeNil)
+				So(v, ShouldEqual, expected)
+			}
+		})
+
+		Convey("values out of range are rejected", func() {
+			for dataType, s := range map[string]string{
+				"uint8": "256", "uint16": "65536", "uint32": "4294967296", "uint64": "18446744073709551616",
+				"int8": "-129", "int16": "32768", "int32": "2147483648", "int64": "9223372036854775808",
+				"float32": "1e39",
+			} {
+				_, err := convertMetricType([]byte(s), dataType)
+				So(err, ShouldNotBeNil)
+				So(err.Error(), ShouldEqual, fmt.Sprintf("Value %q is out of range of %s", s, dataType))
+			}
+			v, err := convertMetricType([]byte("255"), "uint8")
+			So(err, ShouldBeNil)
+			So(v, ShouldEqual, uint32(255))
+		})
+
+		Convey("negative values of unsigned types are rejected", func() {
+			_, err := convertMetricType([]byte("-1"), "uint32")
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldEqual, `Cannot parse "-1" as uint32`)
+		})
+
+		Convey("prefixes are accepted only when enabled", func() {
+			format := numberFormat{prefixes: true}
+			for s, expected := range map[string]int64{"0x1F": 31, "0o17": 15, "017": 15, "0b101": 5, "-0x10": -16, "0": 0, "10": 10} {
+				v, err := convertMetricValue([]byte(s), "int64", format)
+				So(err, ShouldBeNil)
+				So(v, ShouldEqual, expected)
+			}
+			v, err := convertMetricValue([]byte("0xFF"), "uint8", format)
+			So(err, ShouldBeNil)
+			So(v, ShouldEqual, uint32(255))
+
+			_, err = convertMetricValue([]byte("0x100"), "uint8", format)
+			So(err, ShouldNotBeNil)
+			_, err = convertMetricValue([]byte("0x-5"), "int64", format)
+			So(err, ShouldNotBeNil)
+			_, err = convertMetricValue([]byte("09"), "int64", format)
+			So(err, ShouldNotBeNil)
+			_, err = convertMetricType([]byte("0x1F"), "int64")
+			So(err, ShouldNotBeNil)
+			v, err = convertMetricType([]byte("017"), "int64")
+			So(err, ShouldBeNil)
+			So(v, ShouldEqual, int64(17))
+		})
+
+		Convey("separators of thousands are removed when configured", func() {
+			format := numberFormat{separator: ","}
+			v, err := convertMetricValue([]byte("1,234,567"), "uint32", format)
+			So(err, ShouldBeNil)
+			So(v, ShouldEqual, uint32(1234567))
+			v, err = convertMetricValue([]byte("-1,234.5"), "float64", format)
+			So(err, ShouldBeNil)
+			So(v, ShouldEqual, -1234.5)
+			_, err = convertMetricType([]byte("1,234"), "int64")
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("separator of thousands must be a single character which is not part of numbers", func() {
+			So(validateThousandsSeparator(""), ShouldBeNil)
+			So(validateThousandsSeparator(","), ShouldBeNil)
+			So(validateThousandsSeparator("'"), ShouldBeNil)
+			So(validateThousandsSeparator(" "), ShouldBeNil)
+			So(validateThousandsSeparator("."), ShouldNotBeNil)
+			So(validateThousandsSeparator("0"), ShouldNotBeNil)
+			So(validateThousandsSeparator(",,"), ShouldNotBeNil)
+		})
+
+		Convey("format of numbers is defined in setfile", func() {
+			createMockFile([]byte(`{"hex": {"exec": "/bin/echo", "type": "uint16", "integer_prefixes": true, "thousands_separator": "_"}}`))
+			defer deleteMockFile()
+			setFile, serr := New().loadSetFile(mockFilePath, "", false)
+			So(serr, ShouldBeNil)
+			So(setFile.metrics["hex"].numberFormat(), ShouldResemble, numberFormat{prefixes: true, separator: "_"})
+
+			createMockFile([]byte(`{"hex": {"exec": "/bin/echo", "type": "uint16", "thousands_separator": "."}}`))
+			_, serr = New().loadSetFile(mockFilePath, "", false)
+			So(serr, ShouldNotBeNil)
+			So(serr.Error(), ShouldContainSubstring, "thousands_separator must be a single character")
+		})
+	})
+}
+
+// snapDataType reports if data can be sent to snapd, it mirrors conversion of metrics to protobuf
+// in snap-plugin-lib-go (toProtoMetric), which is not exported
+func snapDataType(data interface{}) bool {
+	switch data.(type) {
+	case string, float64, float32, int32, int, int64, uint32, uint64, []byte, bool, nil:
+		return true
+	}
+	return false
+}
+
+func TestSnapDataTypes(t *testing.T) {
+	Convey("Collected values have types accepted by snap", t, func() {
+		setFile := "{"
+		mts := []plugin.Metric{}
+		for i, dataType := range []string{"float64", "float32", "int64", "int32", "int16", "int8", "uint64", "uint32", "uint16", "uint8", "string"} {
+			if i > 0 {
+				setFile += ","
+			}
+			setFile += fmt.Sprintf(`"%s": {"exec": "/bin/echo", "type": "%s"}`, dataType, dataType)
+			mts = append(mts, plugin.Metric{Namespace: plugin.NewNamespace(vendor, pluginName, dataType)})
+		}
+		createMockFile([]byte(setFile + "}"))
+		defer deleteMockFile()
+
+		config := plugin.Config{}
+		config[setFileConfigVar] = mockFilePath
+		for i := range mts {
+			mts[i].Config = config
+		}
+		p := New()
+		p.cmd = mockExecuteCmd
+		results, err := p.CollectMetrics(mts)
+		So(err, ShouldBeNil)
+		So(len(results), ShouldEqual, len(mts))
+		for _, r := range results {
+			So(snapDataType(r.Data), ShouldBeTrue)
+		}
+	})
+}
@@ -0,0 +1,204 @@
+// +build linux
+
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+
+Copyright 2016 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package collector
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/intelsdi-x/snap/core/serror"
+)
+
+// addShared takes defaults and templates out of setfile content, they can be defined in any of setfiles
+// but defaults only once and each template only once
+func (l *setFileLoader) addShared(content map[string]interface{}, positions map[string]position, logFields map[string]interface{}) serror.SnapError {
+	if defaults, ok := content[defaultsMapKey]; ok {
+		delete(content, defaultsMapKey)
+		pos := positions[keyPath(defaultsMapKey)]
+		if l.defaults != nil {
+			return serror.New(fmt.Errorf("Incorrect structure of settings file, %s are defined more than once, in %s and in %s",
+				defaultsMapKey, l.positions[keyPath(defaultsMapKey)], pos), logFields)
+		}
+		m, ok := defaults.(map[string]interface{})
+		if !ok {
+			return serror.New(fmt.Errorf("Incorrect structure of settings file, %s must be an object at %s", defaultsMapKey, pos), logFields)
+		}
+		if _, ok := m[extendsMapKey]; ok {
+			return serror.New(fmt.Errorf("Incorrect structure of settings file, %s cannot extend templates at %s", defaultsMapKey, pos), logFields)
+		}
+		l.defaults = m
+		copyPositions(positions, l.positions, defaultsMapKey, defaultsMapKey)
+	}
+
+	if templates, ok := content[templatesMapKey]; ok {
+		delete(content, templatesMapKey)
+		m, ok := templates.(map[string]interface{})
+		if !ok {
+			return serror.New(fmt.Errorf("Incorrect structure of settings file, %s must be an object at %s",
+				templatesMapKey, positions[keyPath(templatesMapKey)]), logFields)
+		}
+		names := make([]string, 0, len(m))
+		for name := range m {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			prefix := keyPath(templatesMapKey, name)
+			if _, ok := l.templates[name]; ok {
+				return serror.New(fmt.Errorf("Template %s is defined more than once, in %s and in %s", name, l.positions[prefix], positions[prefix]), logFields)
+			}
+			l.templates[name] = m[name]
+			copyPositions(positions, l.positions, prefix, prefix)
+		}
+	}
+	return nil
+}
+
+// definitionSource settings which are merged into metric definition, prefix identifies them in positions
+type definitionSource struct {
+	prefix     string
+	definition map[string]interface{}
+}
+
+// resolveDefinition returns definition of metric merged with defaults and templates extended by it,
+// positions of fields inherited from defaults and templates are added to positions of metric
+func (l *setFileLoader) resolveDefinition(name string) (interface{}, error) {
+	definition, ok := l.definitions[name].(map[string]interface{})
+	if !ok {
+		//incorrect definition is reported by validation
+		return l.definitions[name], nil
+	}
+
+	sources := []definitionSource{}
+	if l.defaults != nil {
+		if err := validateMetricDefinition(defaultsMapKey, l.defaults, l.positions); err != nil {
+			return nil, err
+		}
+		sources = append(sources, definitionSource{prefix: defaultsMapKey, definition: l.defaults})
+	}
+	inherited, err := l.extendedSources(name, definition, nil)
+	if err != nil {
+		return nil, err
+	}
+	sources = append(sources, inherited...)
+
+	resolved := map[string]interface{}{}
+	for _, source := range sources {
+		//exec and script of a more specific source replace the other one inherited from earlier sources
+		_, hasExec := source.definition[metricExecMapKey]
+		_, hasScript := source.definition[scriptMapKey]
+		if hasExec && !hasScript {
+			delete(resolved, scriptMapKey)
+		} else if hasScript && !hasExec {
+			delete(resolved, metricExecMapKey)
+		}
+		resolved = mergeDefinitions(resolved, source.definition)
+	}
+	delete(resolved, extendsMapKey)
+	if _, ok := resolved[scriptMapKey]; !ok {
+		//inherited interpreter applies only to scripts, interpreter of the metric itself is reported by validation
+		if _, ok := definition[interpreterMapKey]; !ok {
+			delete(resolved, interpreterMapKey)
+		}
+	}
+
+	for i := len(sources) - 2; i >= 0; i-- {
+		copyPositions(l.positions, l.positions, sources[i].prefix, name)
+	}
+	return resolved, nil
+}
+
+// extendedSources returns templates extended by definition, recursively and in order of precedence,
+// followed by the definition itself
+func (l *setFileLoader) extendedSources(prefix string, definition map[string]interface{}, chain []string) ([]definitionSource, error) {
+	extends, err := stringsOf(extendsMapKey, definition[extendsMapKey])
+	if err != nil {
+		return nil, fmt.Errorf("%v at %s", err, positionOf(l.positions, []string{prefix, extendsMapKey}))
+	}
+
+	sources := []definitionSource{}
+	for _, name := range extends {
+		for _, c := range chain {
+			if c == name {
+				return nil, fmt.Errorf("Template %s extends itself through %s", name, strings.Join(append(chain, name), " -> "))
+			}
+		}
+		templatePrefix := keyPath(templatesMapKey, name)
+		value, ok := l.templates[name]
+		if !ok {
+			return nil, fmt.Errorf("%s extends undefined template %s at %s", prefix, name, positionOf(l.positions, []string{prefix, extendsMapKey}))
+		}
+		template, ok := value.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("Template %s must be an object at %s", name, l.positions[templatePrefix])
+		}
+		withoutExtends := mergeDefinitions(map[string]interface{}{}, template)
+		delete(withoutExtends, extendsMapKey)
+		if err := validateMetricDefinition(templatePrefix, withoutExtends, l.positions); err != nil {
+			return nil, err
+		}
+
+		inherited, err := l.extendedSources(templatePrefix, template, append(chain, name))
+		if err != nil {
+			return nil, err
+		}
+		sources = append(sources, inherited...)
+	}
+
+	return append(sources, definitionSource{prefix: prefix, definition: definition}), nil
+}
+
+// mergeDefinitions returns copy of base overridden by fields of override, objects (e.g. env) are merged
+// key by key, other values are replaced
+func mergeDefinitions(base map[string]interface{}, override map[string]interface{}) map[string]interface{} {
+	merged := map[string]interface{}{}
+	for k, v := range base {
+		merged[k] = v
+	}
+	for k, v := range override {
+		baseObject, baseOk := merged[k].(map[string]interface{})
+		overrideObject, overrideOk := v.(map[string]interface{})
+		if baseOk && overrideOk {
+			merged[k] = mergeDefinitions(baseObject, overrideObject)
+			continue
+		}
+		merged[k] = v
+	}
+	return merged
+}
+
+// copyPositions copies positions of elements with given prefix to elements with another prefix,
+// positions which are already defined are kept
+func copyPositions(from map[string]position, to map[string]position, fromPrefix string, toPrefix string) {
+	copied := map[string]position{}
+	for k, pos := range from {
+		if k == fromPrefix || strings.HasPrefix(k, fromPrefix+".") {
+			copied[toPrefix+strings.TrimPrefix(k, fromPrefix)] = pos
+		}
+	}
+	for k, pos := range copied {
+		if _, ok := to[k]; !ok {
+			to[k] = pos
+		}
+	}
+}
@@ -0,0 +1,165 @@
+// +build linux
+
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+
+Copyright 2016 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package collector
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestMergeDefinitions(t *testing.T) {
+	Convey("Merging definitions", t, func() {
+		base := map[string]interface{}{
+			"exec": "/bin/sh",
+			"args": []interface{}{"-c", "true"},
+			"env":  map[string]interface{}{"LC_ALL": "C", "A": "1"},
+		}
+		override := map[string]interface{}{
+			"args": []interface{}{"-x"},
+			"env":  map[string]interface{}{"A": "2"},
+		}
+		merged := mergeDefinitions(base, override)
+		So(merged["exec"], ShouldEqual, "/bin/sh")
+		So(merged["args"], ShouldResemble, []interface{}{"-x"})
+		So(merged["env"], ShouldResemble, map[string]interface{}{"LC_ALL": "C", "A": "2"})
+		So(base["env"], ShouldResemble, map[string]interface{}{"LC_ALL": "C", "A": "1"})
+	})
+}
+
+func TestGetMetricsFromConfigDefaults(t *testing.T) {
+	Convey("Loading setfile with defaults and templates", t, func() {
+		dir, err := ioutil.TempDir("", "exec-defaults")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+		path := filepath.Join(dir, "setfile.json")
+
+		Convey("metrics are merged with defaults and extended templates", func() {
+			So(ioutil.WriteFile(path, mockFileContDefaults, 0644), ShouldBeNil)
+			loaded, serr := getMetricsFromConfig(path, "", false)
+			So(serr, ShouldBeNil)
+			So(len(loaded.metrics), ShouldEqual, 3)
+
+			So(loaded.metrics["plain"], ShouldResemble, metric{
+				Exec: "/bin/echo", Type: "string", Args: []string{"plain"},
+				Env: map[string]string{"LC_ALL": "C"}, Cwd: "/tmp",
+			})
+			So(loaded.metrics["shell"], ShouldResemble, metric{
+				Exec: "/bin/sh", Type: "int64", Args: []string{"-c", "echo 1"},
+				Env: map[string]string{"LC_ALL": "C", "SHELL_OPTS": "-e"}, Cwd: "/tmp",
+			})
+			So(loaded.metrics["strict_shell"], ShouldResemble, metric{
+				Exec: "/bin/sh", Type: "int64", Args: []string{"-c", "echo 2"},
+				Env: map[string]string{"LC_ALL": "POSIX", "SHELL_OPTS": "-eu"}, Cwd: "/var/tmp",
+			})
+		})
+
+		Convey("defaults and templates can be defined in other fragments", func() {
+			So(ioutil.WriteFile(filepath.Join(dir, "a.json"), []byte(`{"defaults": {"type": "string"}, "templates": {"echo": {"exec": "/bin/echo"}}}`), 0644), ShouldBeNil)
+			So(ioutil.WriteFile(filepath.Join(dir, "b.json"), []byte(`{"metric0": {"extends": "echo"}}`), 0644), ShouldBeNil)
+			loaded, serr := getMetricsFromConfig(dir, "", false)
+			So(serr, ShouldBeNil)
+			So(loaded.metrics["metric0"], ShouldResemble, metric{Exec: "/bin/echo", Type: "string"})
+		})
+
+		Convey("defaults can be defined only once", func() {
+			So(ioutil.WriteFile(filepath.Join(dir, "a.json"), []byte(`{"defaults": {"type": "string"}}`), 0644), ShouldBeNil)
+			So(ioutil.WriteFile(filepath.Join(dir, "b.json"), []byte(`{"defaults": {"type": "int64"}}`), 0644), ShouldBeNil)
+			_, serr := getMetricsFromConfig(dir, "", false)
+			So(serr, ShouldNotBeNil)
+			So(serr.Error(), ShouldContainSubstring, "defaults are defined more than once")
+		})
+
+		Convey("undefined template is reported", func() {
+			So(ioutil.WriteFile(path, []byte(`{"metric0": {"exec": "/bin/echo", "type": "string", "extends": ["missing"]}}`), 0644), ShouldBeNil)
+			_, serr := getMetricsFromConfig(path, "", false)
+			So(serr, ShouldNotBeNil)
+			So(serr.Error(), ShouldContainSubstring, "metric0 extends undefined template missing at "+path+":1:")
+		})
+
+		Convey("cyclic templates are reported", func() {
+			So(ioutil.WriteFile(path, []byte(`{"templates": {"a": {"extends": "b"}, "b": {"extends": "a"}}, "metric0": {"extends": "a"}}`), 0644), ShouldBeNil)
+			_, serr := getMetricsFromConfig(path, "", false)
+			So(serr, ShouldNotBeNil)
+			So(serr.Error(), ShouldContainSubstring, "Template a extends itself through a -> b -> a")
+		})
+
+		Convey("errors in templates are reported with their location", func() {
+			So(ioutil.WriteFile(path, []byte("{\"templates\": {\"a\": {\n\"tpye\": \"string\"}},\n\"metric0\": {\"exec\": \"/bin/echo\", \"type\": \"string\", \"extends\": \"a\"}}"), 0644), ShouldBeNil)
+			_, serr := getMetricsFromConfig(path, "", false)
+			So(serr, ShouldNotBeNil)
+			So(serr.Error(), ShouldContainSubstring, "unknown field tpye (did you mean type?) in field tpye of templates.a at "+path+":2:1")
+		})
+
+		Convey("inherited interpreter applies only to scripts", func() {
+			So(ioutil.WriteFile(path, []byte(`{"defaults": {"interpreter": "/bin/sh", "type": "string"}, "templates": {"echo": {"exec": "/bin/echo"}}, "plain": {"exec": "/bin/echo"}, "script": {"script": "echo 1"}, "extended": {"extends": "echo", "script": "echo 2"}}`), 0644), ShouldBeNil)
+			loaded, serr := getMetricsFromConfig(path, "", false)
+			So(serr, ShouldBeNil)
+			So(loaded.metrics["plain"], ShouldResemble, metric{Exec: "/bin/echo", Type: "string"})
+			So(loaded.metrics["script"], ShouldResemble, metric{Script: "echo 1", Interpreter: "/bin/sh", Type: "string"})
+			So(loaded.metrics["extended"], ShouldResemble, metric{Script: "echo 2", Interpreter: "/bin/sh", Type: "string"})
+		})
+
+		Convey("interpreter of metric without script is reported", func() {
+			So(ioutil.WriteFile(path, []byte(`{"defaults": {"type": "string"}, "plain": {"exec": "/bin/echo", "interpreter": "/bin/sh"}}`), 0644), ShouldBeNil)
+			_, serr := getMetricsFromConfig(path, "", false)
+			So(serr, ShouldNotBeNil)
+			So(serr.Error(), ShouldContainSubstring, "interpreter can be used only with script for plain")
+		})
+
+		Convey("missing fields of metric are reported", func() {
+			So(ioutil.WriteFile(path, []byte(`{"templates": {"a": {"type": "string"}}, "metric0": {"extends": "a"}}`), 0644), ShouldBeNil)
+			_, serr := getMetricsFromConfig(path, "", false)
+			So(serr, ShouldNotBeNil)
+			So(serr.Error(), ShouldContainSubstring, "missing metric exec for metric0")
+		})
+	})
+}
+
+var mockFileContDefaults = []byte(`{
+	"defaults": {
+		"type": "string",
+		"env": {"LC_ALL": "C"},
+		"cwd": "/tmp"
+	},
+	"templates": {
+		"shell": {
+			"exec": "/bin/sh",
+			"type": "int64",
+			"env": {"SHELL_OPTS": "-e"}
+		},
+		"strict": {
+			"extends": "shell",
+			"env": {"SHELL_OPTS": "-eu"}
+		},
+		"posix": {
+			"env": {"LC_ALL": "POSIX"},
+			"cwd": "/var/tmp"
+		}
+	},
+	"plain": {"exec": "/bin/echo", "args": ["plain"]},
+	"shell": {"extends": "shell", "args": ["-c", "echo 1"]},
+	"strict_shell": {"extends": ["strict", "posix"], "args": ["-c", "echo 2"]}
+}`)
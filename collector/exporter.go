@@ -0,0 +1,262 @@
+// +build linux
+
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+
+Copyright 2016 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package collector
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/intelsdi-x/snap-plugin-lib-go/v1/plugin"
+)
+
+const (
+	//exporterPath path on which metrics are served in Prometheus exposition format
+	exporterPath = "/metrics"
+
+	//expositionContentType content type of Prometheus text exposition format
+	expositionContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+	//successMetric name of metric which reports if collection of metric succeeded
+	successMetric = "exec_metric_success"
+
+	//durationMetric name of metric which reports time of execution of metric
+	durationMetric = "exec_metric_duration_seconds"
+
+	//valueLabel label of string metrics which contains their value
+	valueLabel = "value"
+)
+
+// exporter serves metrics defined in setfile in Prometheus exposition format, commands are executed on scrape
+type exporter struct {
+	plugin   *Plugin
+	config   plugin.Config
+	cacheTTL time.Duration
+	mu       sync.Mutex
+	body     []byte
+	expires  time.Time
+}
+
+// newExporter returns exporter of metrics collected by plugin with given config, results are reused
+// by scrapes within cacheTTL and commands running longer than timeout are killed
+func newExporter(p *Plugin, cfg plugin.Config, cacheTTL time.Duration, timeout time.Duration) *exporter {
+	if timeout > 0 {
+		p.cmd = executeCmdWithTimeout(timeout)
+	}
+	return &exporter{plugin: p, config: cfg, cacheTTL: cacheTTL}
+}
+
+func (e *exporter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != exporterPath {
+		http.NotFound(w, r)
+		return
+	}
+	body, err := e.scrape()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", expositionContentType)
+	w.Write(body)
+}
+
+// scrape collects all metrics and renders them, concurrent scrapes wait for the same collection
+func (e *exporter) scrape() ([]byte, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	now := time.Now()
+	if e.body != nil && now.Before(e.expires) {
+		return e.body, nil
+	}
+
+	//setfile is reloaded if it was modified
+	mts, err := e.plugin.GetMetricTypes(e.config)
+	if err != nil {
+		return nil, err
+	}
+	sort.Sort(byNamespace(mts))
+	for i := range mts {
+		mts[i].Config = e.config
+	}
+	//metadata is rendered from setfile which defined the metrics, even if it is reloaded during collection
+	setFile := e.plugin.currentSetFile()
+
+	results := []collectResult{}
+	if len(mts) > 0 {
+		var serr error
+		results, serr = e.plugin.collect(mts)
+		if serr != nil {
+			return nil, serr
+		}
+	}
+
+	body := renderExposition(mts, results, setFile.metrics)
+	if e.cacheTTL > 0 {
+		e.body = body
+		e.expires = now.Add(e.cacheTTL)
+	}
+	return body, nil
+}
+
+// renderExposition renders results of collection in Prometheus text format, HELP is taken from description of metric,
+// values of string metrics are exposed in label value of sample equal to 1 and dynamic elements of namespaces in labels
+// named by the elements
+func renderExposition(mts []plugin.Metric, results []collectResult, metrics map[string]metric) []byte {
+	var buf bytes.Buffer
+	rendered := map[string]string{}
+
+	for i, r := range results {
+		ns := mts[i].Namespace.String()
+		if r.err != nil {
+			log.WithFields(r.err.Fields()).Warn(r.err.Error())
+			continue
+		}
+		if len(r.metrics) == 0 {
+			continue
+		}
+		name := exposedName(staticElements(mts[i].Namespace))
+		if other, ok := rendered[name]; ok {
+			log.WithFields(map[string]interface{}{"namespace": ns, "other": other}).Warnf("Metric is not exposed, %s is already used", name)
+			continue
+		}
+		rendered[name] = ns
+
+		if description := metrics[r.name].Description; description != "" {
+			fmt.Fprintf(&buf, "# HELP %s %s\n", name, escapeHelp(description))
+		}
+		fmt.Fprintf(&buf, "# TYPE %s gauge\n", name)
+
+		for _, mt := range r.metrics {
+			labels := map[string]string{}
+			for k, v := range mt.Tags {
+				labels[k] = v
+			}
+			for _, elem := range mt.Namespace {
+				if elem.IsDynamic() {
+					labels[elem.Name] = elem.Value
+				}
+			}
+			value := ""
+			if s, ok := mt.Data.(string); ok {
+				labels[valueLabel] = s
+				value = "1"
+			} else {
+				value = formatSampleValue(mt.Data)
+			}
+			fmt.Fprintf(&buf, "%s%s %s\n", name, formatLabels(labels), value)
+		}
+	}
+
+	fmt.Fprintf(&buf, "# HELP %s Whether the last execution of metric succeeded.\n", successMetric)
+	fmt.Fprintf(&buf, "# TYPE %s gauge\n", successMetric)
+	for i, r := range results {
+		success := 1
+		if r.err != nil {
+			success = 0
+		}
+		fmt.Fprintf(&buf, "%s%s %d\n", successMetric, formatLabels(map[string]string{"namespace": mts[i].Namespace.String()}), success)
+	}
+	fmt.Fprintf(&buf, "# HELP %s Duration of the last execution of metric.\n", durationMetric)
+	fmt.Fprintf(&buf, "# TYPE %s gauge\n", durationMetric)
+	for i, r := range results {
+		fmt.Fprintf(&buf, "%s%s %s\n", durationMetric, formatLabels(map[string]string{"namespace": mts[i].Namespace.String()}),
+			formatSampleValue(r.duration.Seconds()))
+	}
+	return buf.Bytes()
+}
+
+// staticElements returns values of elements of namespace which are not dynamic
+func staticElements(ns plugin.Namespace) []string {
+	elems := []string{}
+	for _, elem := range ns {
+		if !elem.IsDynamic() {
+			elems = append(elems, elem.Value)
+		}
+	}
+	return elems
+}
+
+// exposedName converts elements of namespace to name of Prometheus metric, e.g. /intel/exec/db/size to intel_exec_db_size
+func exposedName(elems []string) string {
+	return sanitizeName(strings.Join(elems, "_"), true)
+}
+
+// sanitizeName replaces characters which are not allowed in names of metrics or labels with underscores
+func sanitizeName(name string, allowColon bool) string {
+	b := []byte(name)
+	for i, c := range b {
+		valid := c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (i > 0 && c >= '0' && c <= '9') || (allowColon && c == ':')
+		if !valid {
+			b[i] = '_'
+		}
+	}
+	return string(b)
+}
+
+// formatLabels renders labels sorted by their names
+func formatLabels(labels map[string]string) string {
+	if len(labels) == 0 {
+		return ""
+	}
+	names := make([]string, 0, len(labels))
+	for name := range labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	pairs := []string{}
+	for _, name := range names {
+		pairs = append(pairs, fmt.Sprintf("%s=\"%s\"", sanitizeName(name, false), escapeLabelValue(labels[name])))
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+func escapeHelp(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "\n", `\n`).Replace(s)
+}
+
+func escapeLabelValue(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`).Replace(s)
+}
+
+// formatSampleValue formats numeric value of metric
+func formatSampleValue(data interface{}) string {
+	switch v := data.(type) {
+	case float64:
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	case float32:
+		return strconv.FormatFloat(float64(v), 'g', -1, 32)
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case uint64:
+		return strconv.FormatUint(v, 10)
+	default:
+		return fmt.Sprint(v)
+	}
+}
@@ -0,0 +1,146 @@
+// +build linux
+
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+
+Copyright 2016 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package collector
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/intelsdi-x/snap-plugin-lib-go/v1/plugin"
+	"github.com/intelsdi-x/snap/core/serror"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestExporter(t *testing.T) {
+	Convey("Serving metrics in Prometheus exposition format", t, func() {
+		createMockFile(mockFileContExporter)
+		defer deleteMockFile()
+
+		config := plugin.Config{}
+		config[setFileConfigVar] = mockFilePath
+		config[execTimeOutConfigVar] = int64(10)
+
+		p := New()
+		e := newExporter(p, config, 0, 0)
+		var executions int32
+		p.cmd = func(cmd command) ([]byte, serror.SnapError) {
+			atomic.AddInt32(&executions, 1)
+			if len(cmd.args) > 0 && cmd.args[0] == "version" {
+				return []byte("1.2.3"), nil
+			}
+			return []byte("42"), nil
+		}
+
+		scrape := func(path string) *httptest.ResponseRecorder {
+			w := httptest.NewRecorder()
+			e.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+			return w
+		}
+
+		Convey("values are rendered with HELP and TYPE from setfile", func() {
+			w := scrape("/metrics")
+			So(w.Code, ShouldEqual, http.StatusOK)
+			So(w.Header().Get("Content-Type"), ShouldEqual, expositionContentType)
+			body := w.Body.String()
+			So(body, ShouldContainSubstring, "# HELP intel_exec_db_connections Open connections\n")
+			So(body, ShouldContainSubstring, "# TYPE intel_exec_db_connections gauge\n")
+			So(body, ShouldContainSubstring, "intel_exec_db_connections{team=\"db\"} 42\n")
+			So(body, ShouldContainSubstring, "intel_exec_version{value=\"1.2.3\"} 1\n")
+			So(body, ShouldContainSubstring, "exec_metric_success{namespace=\"/intel/exec/db/connections\"} 1\n")
+		})
+
+		Convey("failed metrics are reported", func() {
+			p.cmd = mockExecuteCmdErr
+			body := scrape("/metrics").Body.String()
+			So(body, ShouldNotContainSubstring, "intel_exec_db_connections{")
+			So(body, ShouldContainSubstring, "exec_metric_success{namespace=\"/intel/exec/db/connections\"} 0\n")
+		})
+
+		Convey("commands are executed on each scrape", func() {
+			scrape("/metrics")
+			scrape("/metrics")
+			So(atomic.LoadInt32(&executions), ShouldEqual, 4)
+		})
+
+		Convey("results are cached", func() {
+			e.cacheTTL = time.Minute
+			scrape("/metrics")
+			scrape("/metrics")
+			So(atomic.LoadInt32(&executions), ShouldEqual, 2)
+		})
+
+		Convey("metadata is rendered from setfile loaded before collection", func() {
+			p.cmd = func(cmd command) ([]byte, serror.SnapError) {
+				//setfile reloaded during collection
+				p.setFile.Store(&setFile{})
+				return []byte("42"), nil
+			}
+			body := scrape("/metrics").Body.String()
+			So(body, ShouldContainSubstring, "# HELP intel_exec_db_connections Open connections\n")
+			So(body, ShouldContainSubstring, "# TYPE intel_exec_db_connections gauge\n")
+		})
+
+		Convey("other paths are not found", func() {
+			So(scrape("/").Code, ShouldEqual, http.StatusNotFound)
+		})
+	})
+}
+
+func TestExecuteCmdWithTimeout(t *testing.T) {
+	Convey("Commands running longer than timeout are killed", t, func() {
+		start := time.Now()
+		_, serr := executeCmdWithTimeout(100*time.Millisecond)(command{path: "/bin/sh", args: []string{"-c", "sleep 5; echo 1"}})
+		So(serr, ShouldNotBeNil)
+		So(serr.Error(), ShouldContainSubstring, "did not finish in time")
+		So(time.Since(start), ShouldBeLessThan, 2*time.Second)
+
+		out, serr := executeCmdWithTimeout(time.Second)(command{path: "/bin/echo", args: []string{"-n", "1"}})
+		So(serr, ShouldBeNil)
+		So(string(out), ShouldEqual, "1")
+	})
+}
+
+func TestExposedName(t *testing.T) {
+	Convey("Names of metrics are converted to Prometheus names", t, func() {
+		So(exposedName([]string{"intel", "exec", "db", "size"}), ShouldEqual, "intel_exec_db_size")
+		So(exposedName([]string{"acme", "cpu-load.1m"}), ShouldEqual, "acme_cpu_load_1m")
+		So(exposedName([]string{"1st"}), ShouldEqual, "_st")
+		So(formatLabels(map[string]string{"b": "x\"y", "a-b": "1"}), ShouldEqual, `{a_b="1",b="x\"y"}`)
+	})
+}
+
+var mockFileContExporter = []byte(`{
+	"db/connections": {
+		"exec": "/bin/echo",
+		"type": "int64",
+		"description": "Open connections",
+		"tags": {"team": "db"}
+	},
+	"version": {
+		"exec": "/bin/echo",
+		"type": "string",
+		"args": ["version"]
+	}
+}`)
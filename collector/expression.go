@@ -0,0 +1,455 @@
+// +build linux
+
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+
+Copyright 2016 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package collector
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+const (
+	//valueVariable name of variable which holds collected value in expression
+	valueVariable = "value"
+
+	//maxExpressionLength max length of expression, it limits also depth of nesting
+	maxExpressionLength = 256
+
+	//maxExactInteger max magnitude of integers which are represented exactly by float64 used in evaluation
+	maxExactInteger = 1 << 53
+)
+
+// exprNode node of parsed expression, values are evaluated as float64
+type exprNode interface {
+	eval(value float64) (float64, error)
+	//integer returns true if node always evaluates to integer
+	integer() bool
+}
+
+type numberNode struct {
+	number float64
+	isInt  bool
+}
+
+func (n numberNode) eval(float64) (float64, error) { return n.number, nil }
+func (n numberNode) integer() bool                 { return n.isInt }
+
+type valueNode struct {
+	isInt bool
+}
+
+func (n valueNode) eval(value float64) (float64, error) { return value, nil }
+func (n valueNode) integer() bool                       { return n.isInt }
+
+type negNode struct {
+	operand exprNode
+}
+
+func (n negNode) eval(value float64) (float64, error) {
+	v, err := n.operand.eval(value)
+	return -v, err
+}
+func (n negNode) integer() bool { return n.operand.integer() }
+
+type binaryNode struct {
+	op          byte
+	left, right exprNode
+}
+
+func (n binaryNode) eval(value float64) (float64, error) {
+	l, err := n.left.eval(value)
+	if err != nil {
+		return 0, err
+	}
+	r, err := n.right.eval(value)
+	if err != nil {
+		return 0, err
+	}
+	switch n.op {
+	case '+':
+		return l + r, nil
+	case '-':
+		return l - r, nil
+	case '*':
+		return l * r, nil
+	case '/':
+		if r == 0 {
+			return 0, fmt.Errorf("division by zero")
+		}
+		return l / r, nil
+	default:
+		if r == 0 {
+			return 0, fmt.Errorf("division by zero")
+		}
+		return math.Mod(l, r), nil
+	}
+}
+
+// integer returns true for integer operands of all operators except division, which always returns float
+func (n binaryNode) integer() bool {
+	return n.op != '/' && n.left.integer() && n.right.integer()
+}
+
+type callNode struct {
+	name string
+	args []exprNode
+}
+
+func (n callNode) eval(value float64) (float64, error) {
+	args := make([]float64, len(n.args))
+	for i, arg := range n.args {
+		v, err := arg.eval(value)
+		if err != nil {
+			return 0, err
+		}
+		args[i] = v
+	}
+	switch n.name {
+	case "abs":
+		return math.Abs(args[0]), nil
+	case "min":
+		return math.Min(args[0], args[1]), nil
+	case "max":
+		return math.Max(args[0], args[1]), nil
+	case "clamp":
+		if args[1] > args[2] {
+			return 0, fmt.Errorf("lower bound of clamp is greater than upper bound")
+		}
+		return math.Min(math.Max(args[0], args[1]), args[2]), nil
+	case "round":
+		if args[0] < 0 {
+			return -math.Floor(-args[0] + 0.5), nil
+		}
+		return math.Floor(args[0] + 0.5), nil
+	case "floor":
+		return math.Floor(args[0]), nil
+	default:
+		return math.Ceil(args[0]), nil
+	}
+}
+
+func (n callNode) integer() bool {
+	switch n.name {
+	case "round", "floor", "ceil":
+		return true
+	}
+	for _, arg := range n.args {
+		if !arg.integer() {
+			return false
+		}
+	}
+	return true
+}
+
+// exprFunctions number of arguments of functions available in expressions
+var exprFunctions = map[string]int{
+	"abs":   1,
+	"min":   2,
+	"max":   2,
+	"clamp": 3,
+	"round": 1,
+	"floor": 1,
+	"ceil":  1,
+}
+
+// expression parsed arithmetic expression which transforms collected value
+type expression struct {
+	source   string
+	dataType string //data type of metric
+	goType   string //Go type of values which are transformed
+	integer  bool   //true if values are integers
+	root     exprNode
+}
+
+// parseExpression parses expression, integerValue defines if value is integer in the expression
+func parseExpression(expr string, integerValue bool) (*expression, error) {
+	if len(expr) > maxExpressionLength {
+		return nil, fmt.Errorf("expression is longer than %d characters", maxExpressionLength)
+	}
+	p := &exprParser{input: expr, integerValue: integerValue}
+	root, err := p.parseSum()
+	if err != nil {
+		return nil, err
+	}
+	p.skipSpace()
+	if p.pos < len(p.input) {
+		return nil, fmt.Errorf("unexpected %q at position %d of expression", p.input[p.pos:], p.pos+1)
+	}
+	return &expression{root: root}, nil
+}
+
+// exprParser recursive descent parser of expressions
+type exprParser struct {
+	input        string
+	pos          int
+	integerValue bool
+}
+
+func (p *exprParser) skipSpace() {
+	for p.pos < len(p.input) && unicode.IsSpace(rune(p.input[p.pos])) {
+		p.pos++
+	}
+}
+
+// peek returns next character which is not a white character or 0 at the end of expression
+func (p *exprParser) peek() byte {
+	p.skipSpace()
+	if p.pos >= len(p.input) {
+		return 0
+	}
+	return p.input[p.pos]
+}
+
+func (p *exprParser) parseSum() (exprNode, error) {
+	left, err := p.parseProduct()
+	if err != nil {
+		return nil, err
+	}
+	for op := p.peek(); op == '+' || op == '-'; op = p.peek() {
+		p.pos++
+		right, err := p.parseProduct()
+		if err != nil {
+			return nil, err
+		}
+		left = binaryNode{op: op, left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *exprParser) parseProduct() (exprNode, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for op := p.peek(); op == '*' || op == '/' || op == '%'; op = p.peek() {
+		p.pos++
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		if op == '%' && (!left.integer() || !right.integer()) {
+			return nil, fmt.Errorf("operator %% requires integer operands")
+		}
+		left = binaryNode{op: op, left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *exprParser) parseUnary() (exprNode, error) {
+	if p.peek() == '-' {
+		p.pos++
+		operand, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return negNode{operand: operand}, nil
+	}
+	return p.parsePrimary()
+}
+
+func (p *exprParser) parsePrimary() (exprNode, error) {
+	c := p.peek()
+	switch {
+	case c == 0:
+		return nil, fmt.Errorf("unexpected end of expression")
+	case c == '(':
+		p.pos++
+		node, err := p.parseSum()
+		if err != nil {
+			return nil, err
+		}
+		if p.peek() != ')' {
+			return nil, fmt.Errorf("missing ) at position %d of expression", p.pos+1)
+		}
+		p.pos++
+		return node, nil
+	case c >= '0' && c <= '9' || c == '.':
+		return p.parseNumber()
+	case c == '_' || unicode.IsLetter(rune(c)):
+		return p.parseIdentifier()
+	}
+	return nil, fmt.Errorf("unexpected %q at position %d of expression", c, p.pos+1)
+}
+
+func (p *exprParser) parseNumber() (exprNode, error) {
+	start := p.pos
+	for p.pos < len(p.input) {
+		c := p.input[p.pos]
+		exponentSign := (c == '+' || c == '-') && p.pos > start && (p.input[p.pos-1] == 'e' || p.input[p.pos-1] == 'E')
+		if !(c >= '0' && c <= '9' || c == '.' || c == 'e' || c == 'E' || exponentSign) {
+			break
+		}
+		p.pos++
+	}
+	literal := p.input[start:p.pos]
+	number, err := strconv.ParseFloat(literal, 64)
+	if err != nil {
+		return nil, fmt.Errorf("incorrect number %s in expression", literal)
+	}
+	return numberNode{number: number, isInt: !strings.ContainsAny(literal, ".eE")}, nil
+}
+
+func (p *exprParser) parseIdentifier() (exprNode, error) {
+	start := p.pos
+	for p.pos < len(p.input) && (p.input[p.pos] == '_' || unicode.IsLetter(rune(p.input[p.pos])) || unicode.IsDigit(rune(p.input[p.pos]))) {
+		p.pos++
+	}
+	name := p.input[start:p.pos]
+	if name == valueVariable {
+		return valueNode{isInt: p.integerValue}, nil
+	}
+
+	argsCount, ok := exprFunctions[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown identifier %s in expression, only %s and functions abs, min, max, clamp, round, floor and ceil are available", name, valueVariable)
+	}
+	if p.peek() != '(' {
+		return nil, fmt.Errorf("missing ( after function %s in expression", name)
+	}
+	p.pos++
+	args := []exprNode{}
+	for p.peek() != ')' {
+		if len(args) > 0 {
+			if p.peek() != ',' {
+				return nil, fmt.Errorf("missing , or ) in arguments of function %s in expression", name)
+			}
+			p.pos++
+		}
+		arg, err := p.parseSum()
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, arg)
+	}
+	p.pos++
+	if len(args) != argsCount {
+		return nil, fmt.Errorf("function %s expects %d arguments, got %d", name, argsCount, len(args))
+	}
+	return callNode{name: name, args: args}, nil
+}
+
+// expressionValueType returns Go type of values of data type which can be transformed by expression
+// and true if the values are integers
+func expressionValueType(dataType string) (string, bool, error) {
+	switch dataType {
+	case "float64", "float32", "int64", "int32", "int16", "int8", "uint64", "uint32", "uint16", "uint8":
+		return dataType, !strings.HasPrefix(dataType, "float"), nil
+	case "bool":
+		return "int64", true, nil
+	case "bytes":
+		return "uint64", true, nil
+	case "duration", "timestamp":
+		return "float64", false, nil
+	}
+	return "", false, fmt.Errorf("expression cannot be used with type %s, only with numeric types", dataType)
+}
+
+// compileExpression parses expression and checks that its result can be stored in data type of metric,
+// nil is returned for empty expression
+func compileExpression(expr string, dataType string) (*expression, error) {
+	if expr == "" {
+		return nil, nil
+	}
+	goType, integer, err := expressionValueType(dataType)
+	if err != nil {
+		return nil, err
+	}
+	parsed, err := parseExpression(expr, integer)
+	if err != nil {
+		return nil, err
+	}
+	if integer && !parsed.root.integer() {
+		return nil, fmt.Errorf("expression returns float, which cannot be stored in %s (%s), use round, floor or ceil", dataType, goType)
+	}
+	parsed.source = expr
+	parsed.dataType = dataType
+	parsed.goType = goType
+	parsed.integer = integer
+	return parsed, nil
+}
+
+// evaluate transforms value converted to data type of metric, the result has the same Go type as value,
+// integers which cannot be represented exactly in evaluation are reported as errors
+func (e *expression) evaluate(data interface{}) (interface{}, error) {
+	value, ok := numericValue(data)
+	if !ok {
+		return nil, fmt.Errorf("Expression cannot be applied to value %v of type %T", data, data)
+	}
+	if !exactInteger(data) {
+		return nil, fmt.Errorf("Value %v is greater than 2^53 and cannot be transformed by expression %s without losing precision", data, e.source)
+	}
+	result, err := e.root.eval(value)
+	if err != nil {
+		return nil, fmt.Errorf("Cannot evaluate expression %s for value %v, %v", e.source, data, err)
+	}
+	if math.IsNaN(result) || math.IsInf(result, 0) {
+		return nil, fmt.Errorf("Expression %s returned %v for value %v", e.source, result, data)
+	}
+	converted, err := parseNumber(strconv.FormatFloat(result, 'f', -1, 64), e.goType, numberFormat{})
+	if err != nil {
+		return nil, fmt.Errorf("Result %v of expression %s is out of range of %s", result, e.source, e.dataType)
+	}
+	if e.integer && math.Abs(result) > maxExactInteger {
+		return nil, fmt.Errorf("Result %v of expression %s for value %v is greater than 2^53 and cannot be computed without losing precision", result, e.source, data)
+	}
+	return converted, nil
+}
+
+// exactInteger returns false for 64-bit integers which cannot be represented exactly by float64
+func exactInteger(data interface{}) bool {
+	switch v := data.(type) {
+	case int64:
+		return v >= -maxExactInteger && v <= maxExactInteger
+	case uint64:
+		return v <= maxExactInteger
+	}
+	return true
+}
+
+// numericValue converts numeric value to float64
+func numericValue(data interface{}) (float64, bool) {
+	switch v := data.(type) {
+	case float64:
+		return v, true
+	case float32:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case int32:
+		return float64(v), true
+	case int16:
+		return float64(v), true
+	case int8:
+		return float64(v), true
+	case uint64:
+		return float64(v), true
+	case uint32:
+		return float64(v), true
+	case uint16:
+		return float64(v), true
+	case uint8:
+		return float64(v), true
+	}
+	return 0, false
+}
@@ -0,0 +1,247 @@
+// +build linux
+
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+
+Copyright 2016 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package collector
+
+import (
+	"testing"
+
+	"github.com/intelsdi-x/snap-plugin-lib-go/v1/plugin"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestEvaluateExpression(t *testing.T) {
+	Convey("Evaluating expressions", t, func() {
+		Convey("arithmetic operators follow usual precedence", func() {
+			for expr, expected := range map[string]float64{
+				"value * 1024":        10240,
+				"value / 100":         0.1,
+				"1 + value * 2":       21,
+				"(1 + value) * 2":     22,
+				"-value + 3":          -7,
+				"--value":             10,
+				"value % 3":           1,
+				"value - 2 - 3":       5,
+				"value / 4 / 5":       0.5,
+				"1.5e1 + value":       25,
+				"clamp(value, 0, 5)":  5,
+				"clamp(-value, 0, 5)": 0,
+				"min(value, 3)":       3,
+				"max(value, 30)":      30,
+				"abs(value - 15)":     5,
+				"round(value / 4)":    3,
+				"round(-value / 4)":   -3,
+				"floor(value / 4)":    2,
+				"ceil(value / 4)":     3,
+				" value*2 ":           20,
+				"max(min(value,8),7)": 8,
+				"round(value * 1.05)": 11,
+				"value / 3 * 3 - 10":  0,
+				"clamp(value, 1, 1)":  1,
+				"floor(-value / 4)":   -3,
+				"ceil(-value / 4)":    -2,
+				"(((value)))":         10,
+				"value - -value":      20,
+				"2 * (value + 0.5)":   21,
+				"value/4":             2.5,
+				"max(value, 10) % 4":  2,
+				"abs(-2.5) * value":   25,
+				"value * 0":           0,
+				"0.5":                 0.5,
+				"round(2.5)":          3,
+				"value - value % 4":   8,
+			} {
+				parsed, err := parseExpression(expr, true)
+				So(err, ShouldBeNil)
+				v, err := parsed.root.eval(10)
+				So(err, ShouldBeNil)
+				So(v, ShouldAlmostEqual, expected)
+			}
+		})
+
+		Convey("incorrect expressions are rejected", func() {
+			for expr, message := range map[string]string{
+				"":                                   "unexpected end of expression",
+				"value *":                            "unexpected end of expression",
+				"value value":                        `unexpected "value" at position 7 of expression`,
+				"(value":                             "missing ) at position 7 of expression",
+				"value $ 2":                          `unexpected "$ 2" at position 7 of expression`,
+				"os.Exit(1)":                         "unknown identifier os in expression, only value and functions abs, min, max, clamp, round, floor and ceil are available",
+				"clamp(value, 0)":                    "function clamp expects 3 arguments, got 2",
+				"abs":                                "missing ( after function abs in expression",
+				"min(value 1)":                       "missing , or ) in arguments of function min in expression",
+				"1.2.3":                              "incorrect number 1.2.3 in expression",
+				"value % 1.5":                        "operator % requires integer operands",
+				"value " + string(make([]byte, 300)): "expression is longer than 256 characters",
+			} {
+				_, err := parseExpression(expr, true)
+				So(err, ShouldNotBeNil)
+				So(err.Error(), ShouldEqual, message)
+			}
+		})
+
+		Convey("result has Go type of declared data type", func() {
+			v, err := evaluate("value * 1024", "uint32", uint32(3))
+			So(err, ShouldBeNil)
+			So(v, ShouldEqual, uint32(3072))
+
+			v, err = evaluate("value / 100", "float32", float32(2345))
+			So(err, ShouldBeNil)
+			So(v, ShouldEqual, float32(23.45))
+
+			v, err = evaluate("1 - value", "bool", int64(1))
+			So(err, ShouldBeNil)
+			So(v, ShouldEqual, int64(0))
+
+			v, err = evaluate("round(value / 1000)", "bytes", uint64(2600))
+			So(err, ShouldBeNil)
+			So(v, ShouldEqual, uint64(3))
+
+			v, err = evaluate("value * 1000", "duration", 1.5)
+			So(err, ShouldBeNil)
+			So(v, ShouldEqual, float64(1500))
+		})
+
+		Convey("results out of range of data type are reported", func() {
+			_, err := evaluate("value * 2", "uint8", uint8(200))
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldEqual, "Result 400 of expression value * 2 is out of range of uint8")
+
+			_, err = evaluate("value - 1", "uint64", uint64(0))
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldEqual, "Result -1 of expression value - 1 is out of range of uint64")
+		})
+
+		Convey("integers which cannot be evaluated exactly are reported", func() {
+			v, err := evaluate("value + 1", "int64", int64(1<<53-1))
+			So(err, ShouldBeNil)
+			So(v, ShouldEqual, int64(1<<53))
+
+			_, err = evaluate("value - 1", "uint64", uint64(1<<53+1))
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldEqual, "Value 9007199254740993 is greater than 2^53 and cannot be transformed by expression value - 1 without losing precision")
+
+			_, err = evaluate("value * 1024", "bytes", uint64(1<<50))
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "is greater than 2^53 and cannot be computed without losing precision")
+		})
+
+		Convey("errors of evaluation are reported", func() {
+			_, err := evaluate("value / (value - 1)", "float64", float64(1))
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldEqual, "Cannot evaluate expression value / (value - 1) for value 1, division by zero")
+
+			_, err = evaluate("clamp(value, 5, 0)", "int64", int64(1))
+			So(err, ShouldNotBeNil)
+
+			_, err = evaluate("value * 1e308 * 10", "float64", float64(1))
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldEqual, "Expression value * 1e308 * 10 returned +Inf for value 1")
+		})
+	})
+}
+
+func TestCompileExpression(t *testing.T) {
+	Convey("Compiling expressions against declared data types", t, func() {
+		for expr, dataType := range map[string]string{
+			"value * 1024":         "int64",
+			"value / 100":          "float64",
+			"round(value / 100)":   "int8",
+			"clamp(value, 0, 100)": "uint8",
+			"value * 0.5":          "duration",
+		} {
+			compiled, err := compileExpression(expr, dataType)
+			So(err, ShouldBeNil)
+			So(compiled, ShouldNotBeNil)
+		}
+
+		compiled, err := compileExpression("", "string")
+		So(err, ShouldBeNil)
+		So(compiled, ShouldBeNil)
+
+		_, err = compileExpression("value / 100", "int64")
+		So(err, ShouldNotBeNil)
+		So(err.Error(), ShouldEqual, "expression returns float, which cannot be stored in int64 (int64), use round, floor or ceil")
+
+		_, err = compileExpression("clamp(value, 0, 1.5)", "bytes")
+		So(err, ShouldNotBeNil)
+		So(err.Error(), ShouldEqual, "expression returns float, which cannot be stored in bytes (uint64), use round, floor or ceil")
+
+		_, err = compileExpression("value + 1", "string")
+		So(err, ShouldNotBeNil)
+		So(err.Error(), ShouldEqual, "expression cannot be used with type string, only with numeric types")
+
+		_, err = compileExpression("value +", "int64")
+		So(err, ShouldNotBeNil)
+	})
+}
+
+// evaluate compiles expression for data type and transforms value with it
+func evaluate(expr string, dataType string, data interface{}) (interface{}, error) {
+	compiled, err := compileExpression(expr, dataType)
+	if err != nil {
+		return nil, err
+	}
+	return compiled.evaluate(data)
+}
+
+func TestCollectWithExpression(t *testing.T) {
+	Convey("Collecting metrics transformed by expressions", t, func() {
+		createMockFile([]byte(`{
+			"memory": {"exec": "/bin/echo", "type": "uint64", "expression": "value * 1024"},
+			"temperature": {"exec": "/bin/echo", "type": "float64", "expression": "value / 100"},
+			"overflow": {"exec": "/bin/echo", "type": "int8", "expression": "value * 2"}
+		}`))
+		defer deleteMockFile()
+
+		config := plugin.Config{}
+		config[setFileConfigVar] = mockFilePath
+		config[execTimeOutConfigVar] = int64(10)
+
+		plg := New()
+		plg.cmd = mockExecuteCmd
+		_, err := plg.GetMetricTypes(config)
+		So(err, ShouldBeNil)
+
+		collect := func(name string) []plugin.Metric {
+			results, err := plg.CollectMetrics([]plugin.Metric{{Namespace: plugin.NewNamespace(vendor, pluginName, name), Config: config}})
+			So(err, ShouldBeNil)
+			return results
+		}
+
+		memory := collect("memory")
+		So(len(memory), ShouldEqual, 1)
+		So(memory[0].Data, ShouldEqual, uint64(66560))
+
+		temperature := collect("temperature")
+		So(len(temperature), ShouldEqual, 1)
+		So(temperature[0].Data, ShouldEqual, 0.65)
+
+		So(collect("overflow"), ShouldBeEmpty)
+
+		Convey("expressions are checked when setfile is loaded", func() {
+			createMockFile([]byte(`{"temperature": {"exec": "/bin/echo", "type": "int64", "expression": "value / 100"}}`))
+			_, err := New().GetMetricTypes(config)
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "expression returns float, which cannot be stored in int64 (int64), use round, floor or ceil for temperature")
+		})
+	})
+}
@@ -0,0 +1,232 @@
+// +build linux
+
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+
+Copyright 2016 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package collector
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	//jsonFormat setfile in JSON format, used also for files with unknown extension
+	jsonFormat = "json"
+
+	//yamlFormat setfile in YAML format
+	yamlFormat = "yaml"
+
+	//tomlFormat setfile in TOML format
+	tomlFormat = "toml"
+)
+
+// setFileExtensions extensions of setfiles in supported formats
+var setFileExtensions = map[string][]string{
+	jsonFormat: {".json"},
+	yamlFormat: {".yaml", ".yml"},
+	tomlFormat: {".toml"},
+}
+
+// validateSetFileFormat checks if explicitly configured format of setfile is supported
+func validateSetFileFormat(format string) error {
+	if _, ok := setFileExtensions[format]; format != "" && !ok {
+		return fmt.Errorf("Unsupported format of settings file %s, expected %s, %s or %s", format, jsonFormat, yamlFormat, tomlFormat)
+	}
+	return nil
+}
+
+// setFileFormatOf returns format of setfile, explicitly configured format takes precedence over extension of file
+func setFileFormatOf(path string, format string) string {
+	if format != "" {
+		return format
+	}
+	ext := strings.ToLower(filepath.Ext(path))
+	for f, extensions := range setFileExtensions {
+		for _, e := range extensions {
+			if e == ext {
+				return f
+			}
+		}
+	}
+	return jsonFormat
+}
+
+// hasSetFileExtension returns true if file has extension of setfile in given format
+// or in any of supported formats if format is not configured
+func hasSetFileExtension(path string, format string) bool {
+	ext := strings.ToLower(filepath.Ext(path))
+	for f, extensions := range setFileExtensions {
+		if format != "" && f != format {
+			continue
+		}
+		for _, e := range extensions {
+			if e == ext {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// decodeSetFile decodes content of setfile and returns positions of its keys
+func decodeSetFile(path string, content []byte, format string) (map[string]interface{}, map[string]position, error) {
+	var decoded map[string]interface{}
+
+	switch setFileFormatOf(path, format) {
+	case yamlFormat:
+		var doc yaml.Node
+		if err := yaml.Unmarshal(content, &doc); err != nil {
+			return nil, nil, err
+		}
+		if len(doc.Content) == 0 || doc.Content[0].Kind != yaml.MappingNode {
+			return nil, nil, fmt.Errorf("top-level element of settings file must be a mapping")
+		}
+		if err := doc.Content[0].Decode(&decoded); err != nil {
+			return nil, nil, err
+		}
+		positions := map[string]position{}
+		yamlKeyPositions(path, doc.Content[0], nil, positions)
+		return decoded, positions, nil
+	case tomlFormat:
+		if _, err := toml.Decode(string(content), &decoded); err != nil {
+			return nil, nil, err
+		}
+		return normalizeTOMLValue(decoded).(map[string]interface{}), tomlKeyPositions(path, content), nil
+	default:
+		if err := json.Unmarshal(content, &decoded); err != nil {
+			return nil, nil, err
+		}
+		if decoded == nil {
+			return nil, nil, fmt.Errorf("top-level element of settings file must be an object")
+		}
+		return decoded, jsonKeyPositions(path, content), nil
+	}
+}
+
+// normalizeTOMLValue converts arrays of tables decoded from TOML to lists of objects as decoded from JSON and YAML
+func normalizeTOMLValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for k, item := range v {
+			v[k] = normalizeTOMLValue(item)
+		}
+	case []map[string]interface{}:
+		items := make([]interface{}, len(v))
+		for i, item := range v {
+			items[i] = normalizeTOMLValue(item)
+		}
+		return items
+	case []interface{}:
+		for i, item := range v {
+			v[i] = normalizeTOMLValue(item)
+		}
+	}
+	return value
+}
+
+// yamlKeyPositions collects positions of mapping keys and sequence items of YAML node
+func yamlKeyPositions(file string, node *yaml.Node, path []string, positions map[string]position) {
+	switch node.Kind {
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key := node.Content[i]
+			elemPath := append(append([]string{}, path...), key.Value)
+			positions[keyPath(elemPath...)] = position{file: file, line: key.Line, column: key.Column}
+			yamlKeyPositions(file, node.Content[i+1], elemPath, positions)
+		}
+	case yaml.SequenceNode:
+		for i, item := range node.Content {
+			elemPath := append(append([]string{}, path...), strconv.Itoa(i))
+			positions[keyPath(elemPath...)] = position{file: file, line: item.Line, column: item.Column}
+			yamlKeyPositions(file, item, elemPath, positions)
+		}
+	}
+}
+
+// tomlKeyPositions returns positions of table headers and keys defined in TOML document,
+// TOML decoder does not expose positions, so they are found by scanning lines of the document
+func tomlKeyPositions(file string, content []byte) map[string]position {
+	positions := map[string]position{}
+	table := []string{}
+	//number of tables in each array of tables
+	arrays := map[string]int{}
+
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	multiline := ""
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		line := scanner.Text()
+		trimmed := strings.TrimSpace(line)
+		column := len(line) - len(strings.TrimLeft(line, " \t")) + 1
+
+		//skip content of multi-line strings
+		if multiline != "" {
+			if strings.Count(trimmed, multiline)%2 == 1 {
+				multiline = ""
+			}
+			continue
+		}
+
+		switch {
+		case trimmed == "" || strings.HasPrefix(trimmed, "#"):
+		case strings.HasPrefix(trimmed, "["):
+			header := strings.Trim(trimmed[:strings.LastIndex(trimmed, "]")+1], "[]")
+			table = splitTOMLKey(header)
+			if strings.HasPrefix(trimmed, "[[") {
+				key := keyPath(table...)
+				if arrays[key] == 0 {
+					positions[key] = position{file: file, line: lineNo, column: column}
+				}
+				table = append(table, fmt.Sprint(arrays[key]))
+				arrays[key]++
+			}
+			positions[keyPath(table...)] = position{file: file, line: lineNo, column: column}
+		default:
+			eq := strings.Index(trimmed, "=")
+			if eq < 0 {
+				continue
+			}
+			key := append(append([]string{}, table...), splitTOMLKey(trimmed[:eq])...)
+			positions[keyPath(key...)] = position{file: file, line: lineNo, column: column}
+			for _, quotes := range []string{`"""`, `'''`} {
+				if strings.Count(trimmed[eq:], quotes)%2 == 1 {
+					multiline = quotes
+				}
+			}
+		}
+	}
+	return positions
+}
+
+// splitTOMLKey splits dotted TOML key into its parts
+func splitTOMLKey(key string) []string {
+	parts := []string{}
+	for _, part := range strings.Split(key, ".") {
+		parts = append(parts, strings.Trim(strings.TrimSpace(part), `"'`))
+	}
+	return parts
+}
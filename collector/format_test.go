@@ -0,0 +1,189 @@
+// +build linux
+
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+
+Copyright 2016 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package collector
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestSetFileFormatOf(t *testing.T) {
+	Convey("Getting format of setfile", t, func() {
+		So(setFileFormatOf("setfile.json", ""), ShouldEqual, jsonFormat)
+		So(setFileFormatOf("setfile.yaml", ""), ShouldEqual, yamlFormat)
+		So(setFileFormatOf("setfile.YML", ""), ShouldEqual, yamlFormat)
+		So(setFileFormatOf("setfile.toml", ""), ShouldEqual, tomlFormat)
+		So(setFileFormatOf("setfile", ""), ShouldEqual, jsonFormat)
+		So(setFileFormatOf("setfile.conf", yamlFormat), ShouldEqual, yamlFormat)
+
+		So(validateSetFileFormat(""), ShouldBeNil)
+		So(validateSetFileFormat(tomlFormat), ShouldBeNil)
+		So(validateSetFileFormat("xml"), ShouldNotBeNil)
+	})
+}
+
+func TestDecodeSetFile(t *testing.T) {
+	Convey("Decoding setfile", t, func() {
+
+		Convey("in YAML format", func() {
+			decoded, positions, err := decodeSetFile("setfile.yaml", mockYAMLSetFile, "")
+			So(err, ShouldBeNil)
+			So(decoded, ShouldContainKey, "metric0")
+			So(positions[keyPath("metric1")], ShouldResemble, position{file: "setfile.yaml", line: 4, column: 1})
+			So(positions[keyPath("metric1", "args", "1")], ShouldResemble, position{file: "setfile.yaml", line: 9, column: 7})
+		})
+
+		Convey("in TOML format", func() {
+			decoded, positions, err := decodeSetFile("setfile.toml", mockTOMLSetFile, "")
+			So(err, ShouldBeNil)
+			So(decoded, ShouldContainKey, "metric0")
+			So(positions[keyPath("metric1")], ShouldResemble, position{file: "setfile.toml", line: 5, column: 1})
+			So(positions[keyPath("metric1", "type")], ShouldResemble, position{file: "setfile.toml", line: 11, column: 1})
+			So(positions[keyPath("metric1", "env", "LC_ALL")], ShouldResemble, position{file: "setfile.toml", line: 12, column: 1})
+
+			decoded, positions, err = decodeSetFile("setfile.toml", mockTOMLOutputSetFile, "")
+			So(err, ShouldBeNil)
+			So(decoded["metric2"].(map[string]interface{})["output"], ShouldHaveLength, 2)
+			So(positions[keyPath("metric2", "output")], ShouldResemble, position{file: "setfile.toml", line: 5, column: 1})
+			So(positions[keyPath("metric2", "output", "1", "field")], ShouldResemble, position{file: "setfile.toml", line: 9, column: 1})
+		})
+
+		Convey("with explicitly configured format", func() {
+			decoded, _, err := decodeSetFile("setfile.conf", mockYAMLSetFile, yamlFormat)
+			So(err, ShouldBeNil)
+			So(decoded, ShouldContainKey, "metric0")
+		})
+
+		Convey("when top-level element is not a mapping", func() {
+			_, _, err := decodeSetFile("setfile.yaml", []byte("- metric0"), "")
+			So(err, ShouldNotBeNil)
+			_, _, err = decodeSetFile("setfile.json", []byte("null"), "")
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("when content does not match format", func() {
+			_, _, err := decodeSetFile("setfile.toml", mockYAMLSetFile, "")
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
+
+func TestGetMetricsFromConfigFormats(t *testing.T) {
+	Convey("Loading setfiles in different formats", t, func() {
+		dir, err := ioutil.TempDir("", "exec-formats")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+
+		So(ioutil.WriteFile(filepath.Join(dir, "a.yaml"), mockYAMLSetFile, 0644), ShouldBeNil)
+		So(ioutil.WriteFile(filepath.Join(dir, "b.toml"), []byte("[metric2]\nexec = \"/bin/echo\"\ntype = \"string\"\n"), 0644), ShouldBeNil)
+		So(ioutil.WriteFile(filepath.Join(dir, "c.json"), []byte(`{"metric3": {"exec": "/bin/echo", "type": "string"}}`), 0644), ShouldBeNil)
+
+		Convey("all supported formats are loaded from directory", func() {
+			loaded, serr := getMetricsFromConfig(dir, "", false)
+			So(serr, ShouldBeNil)
+			So(len(loaded.metrics), ShouldEqual, 4)
+			So(loaded.metrics["metric1"].Args[1], ShouldContainSubstring, "awk")
+		})
+
+		Convey("only files in configured format are loaded from directory", func() {
+			loaded, serr := getMetricsFromConfig(dir, tomlFormat, false)
+			So(serr, ShouldBeNil)
+			So(len(loaded.metrics), ShouldEqual, 1)
+		})
+
+		Convey("validation is the same for all formats", func() {
+			So(ioutil.WriteFile(filepath.Join(dir, "d.yaml"), []byte("metric4:\n  exec: /bin/echo\n"), 0644), ShouldBeNil)
+			_, serr := getMetricsFromConfig(dir, "", false)
+			So(serr, ShouldNotBeNil)
+			So(serr.Error(), ShouldContainSubstring, "missing metric type for metric4")
+		})
+
+		Convey("output steps are defined in TOML as arrays of tables", func() {
+			So(ioutil.WriteFile(filepath.Join(dir, "b.toml"), mockTOMLOutputSetFile, 0644), ShouldBeNil)
+			loaded, serr := getMetricsFromConfig(dir, tomlFormat, false)
+			So(serr, ShouldBeNil)
+			So(loaded.metrics["metric2"].Output, ShouldResemble, []outputStep{{Line: -1}, {Field: 2}})
+		})
+
+		Convey("output steps defined in TOML are validated", func() {
+			So(ioutil.WriteFile(filepath.Join(dir, "b.toml"), mockTOMLInvalidOutputSetFile, 0644), ShouldBeNil)
+			_, serr := getMetricsFromConfig(dir, tomlFormat, false)
+			So(serr, ShouldNotBeNil)
+			So(serr.Error(), ShouldContainSubstring, "incorrect regex in step 1 of output")
+			So(serr.Error(), ShouldContainSubstring, "b.toml:5:1")
+		})
+	})
+}
+
+var (
+	mockYAMLSetFile = []byte(`metric0:
+  exec: /bin/ls
+  type: string
+metric1:
+  exec: /bin/sh
+  type: int64
+  args:
+    - -c
+    - |
+      echo "test:1775" | awk -F':' '{printf $2}'
+`)
+
+	mockTOMLOutputSetFile = []byte(`[metric2]
+exec = "/bin/echo"
+type = "int64"
+
+[[metric2.output]]
+line = -1
+
+[[metric2.output]]
+field = 2
+`)
+
+	mockTOMLInvalidOutputSetFile = []byte(`[metric2]
+exec = "/bin/echo"
+type = "int64"
+
+[[metric2.output]]
+line = -1
+
+[[metric2.output]]
+regex = "("
+`)
+
+	mockTOMLSetFile = []byte(`[metric0]
+exec = "/bin/ls"
+type = "string"
+
+[metric1]
+exec = "/bin/sh"
+args = ["-c", """
+echo "test:1775" | \
+  awk -F':' '{printf $2}'
+"""]
+type = "int64"
+env.LC_ALL = "C"
+`)
+)
@@ -0,0 +1,298 @@
+// +build linux
+
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+
+Copyright 2016 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package collector
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"github.com/intelsdi-x/snap-plugin-lib-go/v1/plugin"
+)
+
+const (
+	//hostnameVariable variable replaced with name of host on which plugin runs, e.g. ${hostname}
+	hostnameVariable = "hostname"
+
+	//configVariablePrefix prefix of variables replaced with values of task config of metric, e.g. ${config:port}
+	configVariablePrefix = "config:"
+
+	//secretVariablePrefix prefix of secret references, which are resolved by secrets layer
+	secretVariablePrefix = "secret:"
+)
+
+// variableRefRegexp matches variable references and escaped references, $${name} is replaced with ${name}
+var variableRefRegexp = regexp.MustCompile(`\$\$\{|\$\{([^}]*)\}`)
+
+// envVariableRegexp matches names of environment variables
+var envVariableRegexp = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// variables values which can be referenced in exec, args, env and cwd of metric
+type variables struct {
+	host      string
+	config    plugin.Config
+	templates bool //values are rendered as templates, enabled by template of metric
+}
+
+// newVariables returns variables available during execution of metric with given task config
+func newVariables(host string, cfg plugin.Config) variables {
+	v := variables{host: host, config: plugin.Config{}}
+	if cfg != nil {
+		v.config = cfg
+	}
+	return v
+}
+
+// noValue text printed by templates for undefined keys of task config
+const noValue = "<no value>"
+
+// templateFuncs functions available in templates in setfile
+var templateFuncs = template.FuncMap{
+	"default": templateDefault,
+}
+
+// templateDefault returns value, or given default if value is undefined or empty, e.g. {{ default 80 .Config.port }}
+func templateDefault(def, value interface{}) interface{} {
+	if value == nil || value == "" {
+		return def
+	}
+	return value
+}
+
+// templateData data available in templates in setfile, e.g. {{ .Config.port }}
+type templateData struct {
+	Config map[string]interface{}
+	Host   string
+}
+
+// render executes template in value if templates are enabled, values of task config are escaped,
+// so they are not interpolated afterwards
+func (v variables) render(value string) (string, error) {
+	if !v.templates || !strings.Contains(value, "{{") {
+		return value, nil
+	}
+	tmpl, err := parseTemplate(value)
+	if err != nil {
+		return "", err
+	}
+
+	data := templateData{Config: map[string]interface{}{}, Host: v.host}
+	for key, item := range v.config {
+		switch native := item.(type) {
+		case string:
+			data.Config[key] = strings.Replace(native, "${", "$${", -1)
+		default:
+			data.Config[key] = native
+		}
+	}
+
+	rendered, err := executeTemplate(tmpl, value, data)
+	if err != nil {
+		return "", err
+	}
+	if strings.Contains(rendered, noValue) && !strings.Contains(value, noValue) {
+		return "", fmt.Errorf("Cannot render template %s, task config does not contain a key used in it, use default to provide its value", value)
+	}
+	return rendered, nil
+}
+
+// parseTemplate parses template in setfile value
+func parseTemplate(value string) (*template.Template, error) {
+	tmpl, err := template.New("value").Funcs(templateFuncs).Parse(value)
+	if err != nil {
+		return nil, fmt.Errorf("Incorrect template %s, %v", value, err)
+	}
+	return tmpl, nil
+}
+
+// executeTemplate executes parsed template with given data
+func executeTemplate(tmpl *template.Template, value string, data templateData) (string, error) {
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return "", fmt.Errorf("Cannot render template %s, %v", value, err)
+	}
+	return buf.String(), nil
+}
+
+// interpolate renders template in value and replaces variable references, secret references are resolved
+// only if they are allowed, resolved secret values are returned to allow scrubbing them from logs and errors
+func (v variables) interpolate(value string, allowSecrets bool) (string, []string, error) {
+	value, err := v.render(value)
+	if err != nil {
+		return "", nil, err
+	}
+
+	secrets := []string{}
+	var interpolateErr error
+	interpolated := variableRefRegexp.ReplaceAllStringFunc(value, func(ref string) string {
+		if interpolateErr != nil {
+			return ref
+		}
+		if ref == "$${" {
+			return "${"
+		}
+		name := variableRefRegexp.FindStringSubmatch(ref)[1]
+		if strings.HasPrefix(name, secretVariablePrefix) {
+			if !allowSecrets {
+				interpolateErr = fmt.Errorf("secret references are not allowed in %s", value)
+				return ref
+			}
+			resolved, resolvedSecrets, err := resolveSecrets(ref)
+			if err != nil {
+				interpolateErr = err
+				return ref
+			}
+			secrets = append(secrets, resolvedSecrets...)
+			return resolved
+		}
+		resolved, err := v.lookup(name)
+		if err != nil {
+			interpolateErr = err
+			return ref
+		}
+		return resolved
+	})
+	if interpolateErr != nil {
+		return "", nil, interpolateErr
+	}
+	return interpolated, secrets, nil
+}
+
+// lookup returns value of variable, it fails if variable is not defined
+func (v variables) lookup(name string) (string, error) {
+	if err := validateVariableName(name); err != nil {
+		return "", err
+	}
+	if name == hostnameVariable {
+		return v.host, nil
+	}
+	if strings.HasPrefix(name, configVariablePrefix) {
+		key := strings.TrimPrefix(name, configVariablePrefix)
+		item, ok := v.config[key]
+		if !ok {
+			return "", fmt.Errorf("Undefined variable ${%s}, task config does not contain %s", name, key)
+		}
+		return configValueString(item), nil
+	}
+	value, ok := os.LookupEnv(name)
+	if !ok {
+		return "", fmt.Errorf("Undefined variable ${%s}, environment variable %s is not set", name, name)
+	}
+	return value, nil
+}
+
+// configValueString formats value of task config as string
+func configValueString(item interface{}) string {
+	switch value := item.(type) {
+	case string:
+		return value
+	case int64:
+		return strconv.FormatInt(value, 10)
+	case float64:
+		return strconv.FormatFloat(value, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(value)
+	default:
+		return fmt.Sprint(item)
+	}
+}
+
+// validateVariableName checks syntax of variable name, secret references are validated separately
+func validateVariableName(name string) error {
+	switch {
+	case name == hostnameVariable:
+		return nil
+	case strings.HasPrefix(name, configVariablePrefix):
+		if name == configVariablePrefix {
+			return fmt.Errorf("Incorrect variable reference ${%s}, expected ${%s<key>}", name, configVariablePrefix)
+		}
+		return nil
+	case envVariableRegexp.MatchString(name):
+		return nil
+	default:
+		return fmt.Errorf("Incorrect variable reference ${%s}, use $${%s} to pass it unchanged", name, name)
+	}
+}
+
+// validateVariableRefs checks syntax of all variable references in value
+func validateVariableRefs(value string) error {
+	for _, match := range variableRefRegexp.FindAllStringSubmatch(value, -1) {
+		if match[0] == "$${" || strings.HasPrefix(match[1], secretVariablePrefix) {
+			continue
+		}
+		if err := validateVariableName(match[1]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// validateMetricVariables checks syntax of templates and variable references in exec, interpreter, args, env and cwd of metric,
+// templates are executed with declared parameters of task config, so references to fields which do not exist are reported
+func validateMetricVariables(m metric) error {
+	values := append([]string{m.Exec, m.Interpreter, m.Cwd}, m.Args...)
+	for _, value := range m.Env {
+		values = append(values, value)
+	}
+	for _, value := range values {
+		if m.Template && strings.Contains(value, "{{") {
+			tmpl, err := parseTemplate(value)
+			if err != nil {
+				return err
+			}
+			if _, err := executeTemplate(tmpl, value, declaredTemplateData(m.Config)); err != nil {
+				return err
+			}
+		}
+		if err := validateVariableRefs(value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// declaredTemplateData returns template data with declared parameters of task config set to their defaults
+// or to zero values of their types
+func declaredTemplateData(params map[string]configParam) templateData {
+	data := templateData{Config: map[string]interface{}{}}
+	for name, param := range params {
+		if param.Default != nil {
+			data.Config[name] = param.Default
+			continue
+		}
+		switch param.Type {
+		case integerParam:
+			data.Config[name] = int64(0)
+		case floatParam:
+			data.Config[name] = float64(0)
+		case boolParam:
+			data.Config[name] = false
+		default:
+			data.Config[name] = ""
+		}
+	}
+	return data
+}
@@ -0,0 +1,208 @@
+// +build linux
+
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+
+Copyright 2016 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package collector
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/intelsdi-x/snap-plugin-lib-go/v1/plugin"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestInterpolate(t *testing.T) {
+	Convey("Interpolating variables", t, func() {
+		os.Setenv("EXEC_TEST_DIR", "/opt/exec")
+		defer os.Unsetenv("EXEC_TEST_DIR")
+		os.Setenv("EXEC_TEST_SECRET", "s3cr3t")
+		defer os.Unsetenv("EXEC_TEST_SECRET")
+
+		cfg := plugin.Config{}
+		cfg["port"] = int64(8080)
+		cfg["target"] = "db1"
+		cfg["ratio"] = 0.5
+		vars := newVariables("host1", cfg)
+		templates := newVariables("host1", cfg)
+		templates.templates = true
+
+		Convey("environment variables, hostname and task config are replaced", func() {
+			value, _, err := vars.interpolate("${EXEC_TEST_DIR}/${hostname}/${config:target}:${config:port}/${config:ratio}", false)
+			So(err, ShouldBeNil)
+			So(value, ShouldEqual, "/opt/exec/host1/db1:8080/0.5")
+		})
+
+		Convey("escaped references are passed unchanged", func() {
+			value, _, err := vars.interpolate("for i in 1 2; do echo $${i}; done; echo $$", false)
+			So(err, ShouldBeNil)
+			So(value, ShouldEqual, "for i in 1 2; do echo ${i}; done; echo $$")
+		})
+
+		Convey("undefined variables are reported", func() {
+			_, _, err := vars.interpolate("${EXEC_TEST_UNDEFINED}", false)
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "Undefined variable ${EXEC_TEST_UNDEFINED}")
+			_, _, err = vars.interpolate("${config:missing}", false)
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "task config does not contain missing")
+		})
+
+		Convey("secrets are resolved only when allowed", func() {
+			value, secrets, err := vars.interpolate("${hostname}:${secret:env:EXEC_TEST_SECRET}", true)
+			So(err, ShouldBeNil)
+			So(value, ShouldEqual, "host1:s3cr3t")
+			So(secrets, ShouldResemble, []string{"s3cr3t"})
+			_, _, err = vars.interpolate("${secret:env:EXEC_TEST_SECRET}", false)
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("templates are rendered with task config and hostname", func() {
+			value, _, err := templates.interpolate(`{{ .Config.target }}:{{ .Config.port }}@{{ .Host }}{{ if .Config.ratio }} ratio={{ .Config.ratio }}{{ end }}`, false)
+			So(err, ShouldBeNil)
+			So(value, ShouldEqual, "db1:8080@host1 ratio=0.5")
+		})
+
+		Convey("templates and variable references can be combined", func() {
+			value, _, err := templates.interpolate("${EXEC_TEST_DIR}/{{ .Config.target }}", false)
+			So(err, ShouldBeNil)
+			So(value, ShouldEqual, "/opt/exec/db1")
+		})
+
+		Convey("references in values of task config are not interpolated", func() {
+			cfg["target"] = "${secret:env:EXEC_TEST_SECRET}"
+			templates.config = cfg
+			value, secrets, err := templates.interpolate("{{ .Config.target }}", true)
+			So(err, ShouldBeNil)
+			So(value, ShouldEqual, "${secret:env:EXEC_TEST_SECRET}")
+			So(secrets, ShouldBeEmpty)
+		})
+
+		Convey("undefined keys of task config in templates are reported", func() {
+			_, _, err := templates.interpolate("{{ .Config.missing }}", false)
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "Cannot render template")
+		})
+
+		Convey("undefined keys of task config can be used in conditions and with default", func() {
+			value, _, err := templates.interpolate("{{ if .Config.missing }}{{ .Config.missing }}{{ else }}80{{ end }}:{{ default 443 .Config.missing }}:{{ default 443 .Config.port }}", false)
+			So(err, ShouldBeNil)
+			So(value, ShouldEqual, "80:443:8080")
+		})
+
+		Convey("templates are rendered only when enabled", func() {
+			value, _, err := vars.interpolate("--format {{.Names}}", false)
+			So(err, ShouldBeNil)
+			So(value, ShouldEqual, "--format {{.Names}}")
+			_, _, err = templates.interpolate("--format {{.Names}}", false)
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("syntax of references is validated", func() {
+			So(validateMetricVariables(metric{Exec: "/bin/echo", Template: true, Args: []string{"{{ .Config.port }"}}), ShouldNotBeNil)
+			So(validateMetricVariables(metric{Exec: "/bin/echo", Template: true, Args: []string{"{{ .Config.port }}"}}), ShouldBeNil)
+			So(validateMetricVariables(metric{Exec: "/bin/echo", Args: []string{"{{ .Config.port }"}}), ShouldBeNil)
+			So(validateVariableRefs("${hostname} ${HOME} ${config:port} $${x:-y} ${secret:env:X}"), ShouldBeNil)
+			So(validateVariableRefs("${x:-y}"), ShouldNotBeNil)
+			So(validateVariableRefs("${config:}"), ShouldNotBeNil)
+			So(validateMetricVariables(metric{Exec: "/bin/sh", Args: []string{"-c", "echo ${#x}"}}), ShouldNotBeNil)
+			So(validateMetricVariables(metric{Exec: "/bin/sh", Cwd: "${hostname}"}), ShouldBeNil)
+		})
+
+		Convey("templates are executed with declared parameters of task config", func() {
+			So(validateMetricVariables(metric{Exec: "/usr/bin/docker", Args: []string{"ps", "--format", "{{.Names}}"}}), ShouldBeNil)
+			err := validateMetricVariables(metric{Exec: "/usr/bin/docker", Template: true, Args: []string{"ps", "--format", "{{.Names}}"}})
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "can't evaluate field Names")
+			params := map[string]configParam{"port": {Type: integerParam}, "verbose": {Type: boolParam}}
+			So(validateMetricVariables(metric{Exec: "/bin/echo", Template: true, Config: params,
+				Args: []string{"{{ if .Config.verbose }}-v {{ end }}{{ printf \"%d\" .Config.port }}"}}), ShouldBeNil)
+			So(validateMetricVariables(metric{Exec: "/bin/echo", Template: true, Config: params,
+				Args: []string{"{{ .Config.port.value }}"}}), ShouldNotBeNil)
+		})
+	})
+}
+
+func TestCollectMetricsInterpolation(t *testing.T) {
+	Convey("Collecting metrics with variables", t, func() {
+		dir, err := ioutil.TempDir("", "exec-interpolate")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+		dir, err = filepath.EvalSymlinks(dir)
+		So(err, ShouldBeNil)
+
+		path := filepath.Join(dir, "setfile.json")
+		So(ioutil.WriteFile(path, []byte(`{
+			"pwd": {"exec": "/bin/sh", "type": "string", "args": ["-c", "printf %s:%s $(pwd) $TARGET"],
+				"cwd": "${config:dir}", "env": {"TARGET": "${hostname}-${config:target}"}}
+		}`), 0644), ShouldBeNil)
+
+		config := plugin.Config{}
+		config[setFileConfigVar] = path
+		config[execTimeOutConfigVar] = int64(10)
+
+		mt := func(target string) plugin.Metric {
+			cfg := plugin.Config{}
+			for k, v := range config {
+				cfg[k] = v
+			}
+			cfg["dir"] = dir
+			if target != "" {
+				cfg["target"] = target
+			}
+			return plugin.Metric{Namespace: plugin.NewNamespace(vendor, pluginName, "pwd"), Config: cfg}
+		}
+
+		p := New()
+		p.host = "host1"
+
+		Convey("variables are replaced with values of task config of each metric", func() {
+			results, err := p.CollectMetrics([]plugin.Metric{mt("db1")})
+			So(err, ShouldBeNil)
+			So(len(results), ShouldEqual, 1)
+			So(results[0].Data, ShouldEqual, dir+":host1-db1")
+		})
+
+		Convey("each metric is collected with its own task config", func() {
+			results, err := p.CollectMetrics([]plugin.Metric{mt("db1"), mt("db2")})
+			So(err, ShouldBeNil)
+			So(len(results), ShouldEqual, 2)
+			values := []interface{}{results[0].Data, results[1].Data}
+			So(values, ShouldContain, dir+":host1-db1")
+			So(values, ShouldContain, dir+":host1-db2")
+		})
+
+		Convey("execution timeout is read from config of each metric", func() {
+			m := mt("db1")
+			m.Config[execTimeOutConfigVar] = "1"
+			results, err := p.CollectMetrics([]plugin.Metric{mt("db1"), m})
+			So(err, ShouldBeNil)
+			So(len(results), ShouldEqual, 1)
+		})
+
+		Convey("metric is not collected when variable is undefined", func() {
+			results, err := p.CollectMetrics([]plugin.Metric{mt("")})
+			So(err, ShouldBeNil)
+			So(results, ShouldBeEmpty)
+		})
+	})
+}
@@ -0,0 +1,142 @@
+// +build linux
+
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+
+Copyright 2016 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package collector
+
+import (
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/intelsdi-x/snap-plugin-lib-go/v1/plugin"
+	"github.com/intelsdi-x/snap/core/serror"
+)
+
+// executionLimiter limits number of commands executed concurrently by plugin
+type executionLimiter struct {
+	mu      sync.Mutex
+	cond    *sync.Cond
+	running int
+}
+
+func newExecutionLimiter() *executionLimiter {
+	l := &executionLimiter{}
+	l.cond = sync.NewCond(&l.mu)
+	return l
+}
+
+// acquire waits until fewer than limit commands are running, limit 0 means no limit
+func (l *executionLimiter) acquire(limit int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for limit > 0 && l.running >= limit {
+		l.cond.Wait()
+	}
+	l.running++
+}
+
+// release marks command as finished
+func (l *executionLimiter) release() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.running--
+	l.cond.Broadcast()
+}
+
+// executionLimits limits of executions of commands defined in global config
+type executionLimits struct {
+	concurrency int
+	maxOutput   int
+	allowed     []string
+}
+
+// getExecutionLimits returns limits of executions defined in config
+func getExecutionLimits(cfg plugin.Config) (executionLimits, serror.SnapError) {
+	limits := executionLimits{}
+	var serr serror.SnapError
+	if limits.concurrency, serr = getIntConfigItem(cfg, maxConcurrencyConfigVar, 0); serr != nil {
+		return limits, serr
+	}
+	if limits.maxOutput, serr = getIntConfigItem(cfg, maxOutputSizeConfigVar, 0); serr != nil {
+		return limits, serr
+	}
+	allowed, serr := getStringConfigItem(cfg, allowedExecutablesConfigVar, "")
+	if serr != nil {
+		return limits, serr
+	}
+	limits.allowed = parseAllowedExecutables(allowed)
+	if limits.concurrency < 0 || limits.maxOutput < 0 {
+		return limits, serror.New(fmt.Errorf("%s and %s cannot be negative", maxConcurrencyConfigVar, maxOutputSizeConfigVar), nil)
+	}
+	return limits, nil
+}
+
+// parseAllowedExecutables splits list of allowed executables and directories separated by commas
+func parseAllowedExecutables(allowed string) []string {
+	paths := []string{}
+	for _, path := range strings.Split(allowed, ",") {
+		if path = strings.TrimSpace(path); path != "" {
+			paths = append(paths, filepath.Clean(path))
+		}
+	}
+	return paths
+}
+
+// checkAllowedExecutable checks that executable is one of allowed paths or is located in allowed directory,
+// all executables are allowed when no path is given
+func checkAllowedExecutable(path string, allowed []string) error {
+	if len(allowed) == 0 {
+		return nil
+	}
+	execPath, err := exec.LookPath(path)
+	if err != nil {
+		return fmt.Errorf("Executable %s is not allowed by %s, it cannot be found", path, allowedExecutablesConfigVar)
+	}
+	execPath, err = filepath.Abs(execPath)
+	if err != nil {
+		return fmt.Errorf("Executable %s is not allowed by %s, %v", path, allowedExecutablesConfigVar, err)
+	}
+	for _, allowedPath := range allowed {
+		if execPath == allowedPath || strings.HasPrefix(execPath, strings.TrimSuffix(allowedPath, "/")+"/") {
+			return nil
+		}
+	}
+	return fmt.Errorf("Executable %s is not allowed by %s", execPath, allowedExecutablesConfigVar)
+}
+
+// limitedBuffer keeps at most max bytes of output, the rest of output is discarded, max 0 means no limit
+type limitedBuffer struct {
+	data     []byte
+	max      int
+	exceeded bool
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	if b.max > 0 && len(b.data)+len(p) > b.max {
+		b.data = append(b.data, p[:b.max-len(b.data)]...)
+		b.exceeded = true
+		return len(p), nil
+	}
+	b.data = append(b.data, p...)
+	return len(p), nil
+}
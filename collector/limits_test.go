@@ -0,0 +1,158 @@
+// +build linux
+
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+
+Copyright 2016 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package collector
+
+import (
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/intelsdi-x/snap-plugin-lib-go/v1/plugin"
+	"github.com/intelsdi-x/snap/core/serror"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestExecutionLimiter(t *testing.T) {
+	Convey("Limiting number of concurrent executions", t, func() {
+		l := newExecutionLimiter()
+		var running, max int32
+		done := make(chan struct{})
+		for i := 0; i < 6; i++ {
+			go func() {
+				l.acquire(2)
+				n := atomic.AddInt32(&running, 1)
+				for {
+					m := atomic.LoadInt32(&max)
+					if n <= m || atomic.CompareAndSwapInt32(&max, m, n) {
+						break
+					}
+				}
+				time.Sleep(10 * time.Millisecond)
+				atomic.AddInt32(&running, -1)
+				l.release()
+				done <- struct{}{}
+			}()
+		}
+		for i := 0; i < 6; i++ {
+			<-done
+		}
+		So(atomic.LoadInt32(&max), ShouldEqual, 2)
+	})
+}
+
+func TestCheckAllowedExecutable(t *testing.T) {
+	Convey("Checking executables against allowed paths", t, func() {
+		So(checkAllowedExecutable("/bin/echo", nil), ShouldBeNil)
+		So(checkAllowedExecutable("/bin/echo", parseAllowedExecutables("/bin/echo")), ShouldBeNil)
+		So(checkAllowedExecutable("/bin/echo", parseAllowedExecutables("/usr/local/bin, /bin/")), ShouldBeNil)
+
+		err := checkAllowedExecutable("/bin/echo", parseAllowedExecutables("/bin/ech,/usr/bin/echo"))
+		So(err, ShouldNotBeNil)
+		So(err.Error(), ShouldEqual, "Executable /bin/echo is not allowed by allowed_executables")
+
+		err = checkAllowedExecutable("/bin/missing_executable", parseAllowedExecutables("/bin"))
+		So(err, ShouldNotBeNil)
+		So(err.Error(), ShouldEqual, "Executable /bin/missing_executable is not allowed by allowed_executables, it cannot be found")
+	})
+}
+
+func TestMaxOutputSize(t *testing.T) {
+	Convey("Output of command is limited", t, func() {
+		out, serr := executeCmd(command{path: "/bin/echo", args: []string{"-n", "12345"}, maxOutput: 5})
+		So(serr, ShouldBeNil)
+		So(string(out), ShouldEqual, "12345")
+
+		out, serr = executeCmd(command{path: "/bin/echo", args: []string{"-n", "123456"}, maxOutput: 5})
+		So(serr, ShouldNotBeNil)
+		So(serr.Error(), ShouldEqual, "Output of command is longer than 5 bytes")
+		So(string(out), ShouldEqual, "12345")
+
+		out, serr = executeCmd(command{path: "/bin/echo", args: []string{"-n", "123456"}})
+		So(serr, ShouldBeNil)
+		So(string(out), ShouldEqual, "123456")
+	})
+}
+
+func TestCollectWithLimits(t *testing.T) {
+	Convey("Collecting metrics with execution limits", t, func() {
+		createMockFile([]byte(`{
+			"a": {"exec": "/bin/echo", "type": "int64"},
+			"b": {"exec": "/bin/echo", "type": "int64"},
+			"c": {"exec": "/bin/cat", "type": "int64"}
+		}`))
+		defer deleteMockFile()
+
+		config := plugin.Config{}
+		config[setFileConfigVar] = mockFilePath
+		config[execTimeOutConfigVar] = int64(10)
+
+		plg := New()
+		var running, max int32
+		plg.cmd = func(cmd command) ([]byte, serror.SnapError) {
+			n := atomic.AddInt32(&running, 1)
+			defer atomic.AddInt32(&running, -1)
+			for {
+				m := atomic.LoadInt32(&max)
+				if n <= m || atomic.CompareAndSwapInt32(&max, m, n) {
+					break
+				}
+			}
+			time.Sleep(10 * time.Millisecond)
+			return []byte(fmt.Sprint(cmd.maxOutput)), nil
+		}
+		mts, err := plg.GetMetricTypes(config)
+		So(err, ShouldBeNil)
+		for i := range mts {
+			mts[i].Config = config
+		}
+
+		Convey("commands are executed one by one", func() {
+			config[maxConcurrencyConfigVar] = int64(1)
+			results, err := plg.CollectMetrics(mts)
+			So(err, ShouldBeNil)
+			So(len(results), ShouldEqual, 3)
+			So(atomic.LoadInt32(&max), ShouldEqual, 1)
+		})
+
+		Convey("max size of output is passed to command", func() {
+			config[maxOutputSizeConfigVar] = int64(1024)
+			results, err := plg.CollectMetrics(mts[:1])
+			So(err, ShouldBeNil)
+			So(results[0].Data, ShouldEqual, int64(1024))
+		})
+
+		Convey("only allowed executables are executed", func() {
+			config[allowedExecutablesConfigVar] = "/bin/echo"
+			results, serr := plg.collect(mts)
+			So(serr, ShouldBeNil)
+			for _, r := range results {
+				if r.name == "c" {
+					So(r.err, ShouldNotBeNil)
+					So(r.err.Error(), ShouldEqual, "Executable /bin/cat is not allowed by allowed_executables")
+				} else {
+					So(r.err, ShouldBeNil)
+				}
+			}
+		})
+	})
+}
@@ -0,0 +1,150 @@
+// +build linux
+
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+
+Copyright 2016 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package collector
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/intelsdi-x/snap-plugin-lib-go/v1/plugin"
+	"github.com/intelsdi-x/snap/core/serror"
+)
+
+// namespaceSeparator separates elements of namespace prefix in configuration and of nested metric names in setfile
+const namespaceSeparator = "/"
+
+// parseNamespacePrefix splits namespace prefix defined in configuration, e.g. /acme/exec, into its elements
+func parseNamespacePrefix(prefix string) ([]string, error) {
+	elems := strings.Split(strings.Trim(prefix, namespaceSeparator), namespaceSeparator)
+	if err := validateNamespaceElements(elems); err != nil {
+		return nil, fmt.Errorf("Incorrect namespace prefix %s, %v", prefix, err)
+	}
+	return elems, nil
+}
+
+// validateNamespaceElements checks that elements of namespace are not empty and do not contain
+// separator or wildcards used in task manifests
+func validateNamespaceElements(elems []string) error {
+	if len(elems) == 0 {
+		return fmt.Errorf("namespace cannot be empty")
+	}
+	for _, elem := range elems {
+		if elem == "" {
+			return fmt.Errorf("elements of namespace cannot be empty")
+		}
+		if strings.ContainsAny(elem, namespaceSeparator+"*") {
+			return fmt.Errorf("elements of namespace cannot contain %s or *, got %s", namespaceSeparator, elem)
+		}
+	}
+	return nil
+}
+
+// validateMetricName checks elements of metric name, nested names like db/primary/connections
+// define namespaces with more elements after prefix
+func validateMetricName(name string) error {
+	if err := validateNamespaceElements(strings.Split(name, namespaceSeparator)); err != nil {
+		return fmt.Errorf("Incorrect metric name %s, %v", name, err)
+	}
+	return nil
+}
+
+// getNamespacePrefix returns namespace prefix defined in configuration or default prefix
+func getNamespacePrefix(cfg plugin.Config) ([]string, serror.SnapError) {
+	prefix, serr := getStringConfigItem(cfg, namespacePrefixConfigVar, defaultNamespacePrefix)
+	if serr != nil {
+		return nil, serr
+	}
+	elems, err := parseNamespacePrefix(prefix)
+	if err != nil {
+		return nil, serror.New(err, nil)
+	}
+	return elems, nil
+}
+
+// namespace returns namespace of metric, prefix defined for metric takes precedence over configured prefix,
+// elements of nested metric name are appended to prefix
+func (m metric) namespace(name string, prefix []string) plugin.Namespace {
+	if len(m.Namespace) > 0 {
+		prefix = m.Namespace
+	}
+	return plugin.NewNamespace(append(append([]string{}, prefix...), strings.Split(name, namespaceSeparator)...)...)
+}
+
+// namespaceKey identifies namespace regardless of how snap formats it
+func namespaceKey(ns plugin.Namespace) string {
+	return strings.Join(ns.Strings(), "\x00")
+}
+
+// catalogEntry metric published under namespace
+type catalogEntry struct {
+	name      string
+	column    string //column of table which holds values of metric in table format
+	namespace plugin.Namespace
+}
+
+// catalog returns metrics of setfile by keys of their namespaces, metrics which would be published
+// under the same namespace are reported
+func (s *setFile) catalog(prefix []string) (map[string]catalogEntry, serror.SnapError) {
+	names := make([]string, 0, len(s.metrics))
+	for name := range s.metrics {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	entries := map[string]catalogEntry{}
+	for _, name := range names {
+		for _, entry := range s.metrics[name].catalogEntries(name, prefix) {
+			key := namespaceKey(entry.namespace)
+			if other, ok := entries[key]; ok {
+				return nil, serror.New(fmt.Errorf("Metrics %s and %s have the same namespace %s", other.name, name, entry.namespace.String()),
+					map[string]interface{}{"setFilePath": s.path})
+			}
+			entries[key] = entry
+		}
+	}
+	return entries, nil
+}
+
+// lookupCatalog returns metric published under requested namespace, values of dynamic elements
+// of requested namespace can be given explicitly
+func lookupCatalog(catalog map[string]catalogEntry, ns plugin.Namespace) (catalogEntry, bool) {
+	if entry, ok := catalog[namespaceKey(ns)]; ok {
+		return entry, true
+	}
+	for _, entry := range catalog {
+		if len(entry.namespace) != len(ns) {
+			continue
+		}
+		matches := true
+		for i, elem := range entry.namespace {
+			if !elem.IsDynamic() && elem.Value != ns[i].Value {
+				matches = false
+				break
+			}
+		}
+		if matches {
+			return entry, true
+		}
+	}
+	return catalogEntry{}, false
+}
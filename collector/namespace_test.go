@@ -0,0 +1,205 @@
+// +build linux
+
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+
+Copyright 2016 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package collector
+
+import (
+	"testing"
+
+	"github.com/intelsdi-x/snap-plugin-lib-go/v1/plugin"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestParseNamespacePrefix(t *testing.T) {
+	Convey("Parsing namespace prefix", t, func() {
+		Convey("elements are split by separator", func() {
+			elems, err := parseNamespacePrefix("/acme/exec/")
+			So(err, ShouldBeNil)
+			So(elems, ShouldResemble, []string{"acme", "exec"})
+		})
+
+		Convey("empty elements are refused", func() {
+			_, err := parseNamespacePrefix("/acme//exec")
+			So(err, ShouldNotBeNil)
+			_, err = parseNamespacePrefix("/")
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("wildcards are refused", func() {
+			_, err := parseNamespacePrefix("/acme/*")
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "cannot contain")
+		})
+	})
+}
+
+func TestValidateMetricName(t *testing.T) {
+	Convey("Validating metric names", t, func() {
+		So(validateMetricName("connections"), ShouldBeNil)
+		So(validateMetricName("db/primary/connections"), ShouldBeNil)
+		So(validateMetricName("db//connections"), ShouldNotBeNil)
+		So(validateMetricName("/db/connections"), ShouldNotBeNil)
+		So(validateMetricName("db/*"), ShouldNotBeNil)
+	})
+}
+
+func TestNestedNamespaces(t *testing.T) {
+	Convey("Nested metric names", t, func() {
+		createMockFile(mockFileContNested)
+		defer deleteMockFile()
+
+		config := plugin.Config{}
+		config[setFileConfigVar] = mockFilePath
+		config[execTimeOutConfigVar] = int64(10)
+
+		plg := New()
+		plg.cmd = mockExecuteCmd
+
+		Convey("define namespaces with more elements", func() {
+			mts, err := plg.GetMetricTypes(config)
+			So(err, ShouldBeNil)
+			namespaces := []string{}
+			for _, mt := range mts {
+				namespaces = append(namespaces, mt.Namespace.String())
+			}
+			So(namespaces, ShouldContain, "/intel/exec/db/primary/connections")
+			So(namespaces, ShouldContain, "/intel/exec/db/replica/connections")
+			So(namespaces, ShouldContain, "/acme/db/primary/size")
+		})
+
+		Convey("metrics are collected by nested namespaces", func() {
+			mts := []plugin.Metric{
+				{Namespace: plugin.NewNamespace(vendor, pluginName, "db", "primary", "connections"), Config: config},
+				{Namespace: plugin.NewNamespace("acme", "db", "primary", "size"), Config: config},
+			}
+			results, err := plg.CollectMetrics(mts)
+			So(err, ShouldBeNil)
+			So(len(results), ShouldEqual, 2)
+			So(results[0].Namespace.String(), ShouldEqual, "/intel/exec/db/primary/connections")
+		})
+
+		Convey("metrics with the same namespace are reported", func() {
+			createMockFile([]byte(`{
+				"db/connections": {"exec": "/bin/echo", "type": "int64"},
+				"connections": {"exec": "/bin/echo", "type": "int64", "namespace": ["intel", "exec", "db"]}
+			}`))
+			_, err := plg.GetMetricTypes(config)
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "have the same namespace /intel/exec/db/connections")
+		})
+
+		Convey("incorrect names are refused", func() {
+			createMockFile([]byte(`{"db//connections": {"exec": "/bin/echo", "type": "int64"}}`))
+			_, err := plg.GetMetricTypes(config)
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "Incorrect metric name db//connections")
+		})
+	})
+}
+
+func TestNamespacePrefix(t *testing.T) {
+	Convey("Configurable namespace prefix", t, func() {
+		createMockFile(mockFileContNamespace)
+		defer deleteMockFile()
+
+		config := plugin.Config{}
+		config[setFileConfigVar] = mockFilePath
+		config[execTimeOutConfigVar] = int64(10)
+		config[namespacePrefixConfigVar] = "/acme/exec"
+
+		plg := New()
+		plg.cmd = mockExecuteCmd
+
+		Convey("is used in metric catalog unless metric defines its own namespace", func() {
+			mts, err := plg.GetMetricTypes(config)
+			So(err, ShouldBeNil)
+			namespaces := []string{}
+			for _, mt := range mts {
+				namespaces = append(namespaces, mt.Namespace.String())
+			}
+			So(namespaces, ShouldContain, "/acme/exec/load")
+			So(namespaces, ShouldContain, "/acme/db/connections")
+		})
+
+		Convey("metrics are collected by their namespaces", func() {
+			mts := []plugin.Metric{
+				{Namespace: plugin.NewNamespace("acme", "exec", "load"), Config: config},
+				{Namespace: plugin.NewNamespace("acme", "db", "connections"), Config: config},
+			}
+			results, err := plg.CollectMetrics(mts)
+			So(err, ShouldBeNil)
+			So(len(results), ShouldEqual, 2)
+		})
+
+		Convey("metrics are collected without execution timeout, which has no default outside /intel/exec", func() {
+			delete(config, execTimeOutConfigVar)
+			mts := []plugin.Metric{
+				{Namespace: plugin.NewNamespace("acme", "exec", "load"), Config: config},
+			}
+			results, err := plg.CollectMetrics(mts)
+			So(err, ShouldBeNil)
+			So(len(results), ShouldEqual, 1)
+		})
+
+		Convey("metrics with default prefix are not found", func() {
+			mts := []plugin.Metric{
+				{Namespace: plugin.NewNamespace(vendor, pluginName, "load"), Config: config},
+			}
+			results, err := plg.CollectMetrics(mts)
+			So(err, ShouldBeNil)
+			So(results, ShouldBeEmpty)
+		})
+
+		Convey("incorrect prefix is reported", func() {
+			config[namespacePrefixConfigVar] = "/acme/*"
+			_, err := plg.GetMetricTypes(config)
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
+
+var mockFileContNamespace = []byte(`{
+	"load": {
+		"exec": "/bin/echo",
+		"type": "int64"
+	},
+	"connections": {
+		"exec": "/bin/echo",
+		"type": "int64",
+		"namespace": ["acme", "db"]
+	}
+}`)
+
+var mockFileContNested = []byte(`{
+	"db/primary/connections": {
+		"exec": "/bin/echo",
+		"type": "int64"
+	},
+	"db/replica/connections": {
+		"exec": "/bin/echo",
+		"type": "int64"
+	},
+	"primary/size": {
+		"exec": "/bin/echo",
+		"type": "int64",
+		"namespace": ["acme", "db"]
+	}
+}`)
@@ -0,0 +1,133 @@
+// +build linux
+
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+
+Copyright 2016 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package collector
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// outputStep single step of processing of output of metric, exactly one of trim, line, field and regex is defined
+type outputStep struct {
+	Trim      bool
+	Line      int    //number of selected line starting from 1, negative numbers count lines from the end
+	Field     int    //number of selected field starting from 1
+	Delimiter string //delimiter of fields, by default fields are separated by white characters
+	Regex     string //regular expression, its first capture group or whole match is selected
+}
+
+// validateOutputSteps checks that every step of processing of output defines a single operation
+func validateOutputSteps(steps []outputStep) error {
+	for i, step := range steps {
+		operations := 0
+		if step.Trim {
+			operations++
+		}
+		if step.Line != 0 {
+			operations++
+		}
+		if step.Field != 0 {
+			operations++
+			if step.Field < 0 {
+				return fmt.Errorf("field must be greater than 0 in step %d of output", i)
+			}
+		} else if step.Delimiter != "" {
+			return fmt.Errorf("delimiter can be used only with field in step %d of output", i)
+		}
+		if step.Regex != "" {
+			operations++
+			if _, err := regexp.Compile(step.Regex); err != nil {
+				return fmt.Errorf("incorrect regex in step %d of output, %v", i, err)
+			}
+		}
+		if operations != 1 {
+			return fmt.Errorf("step %d of output must define exactly one of trim, line, field or regex", i)
+		}
+	}
+	return nil
+}
+
+// processOutput applies steps of processing to output of metric
+func processOutput(output []byte, steps []outputStep) ([]byte, error) {
+	for i, step := range steps {
+		var err error
+		switch {
+		case step.Trim:
+			output = bytes.TrimSpace(output)
+		case step.Line != 0:
+			output, err = selectLine(output, step.Line)
+		case step.Field != 0:
+			output, err = selectField(output, step.Field, step.Delimiter)
+		case step.Regex != "":
+			output, err = extractMatch(output, step.Regex)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("Cannot process output in step %d, %v", i, err)
+		}
+	}
+	return output, nil
+}
+
+// selectLine returns n-th line of output without line terminator, negative n counts lines from the end
+func selectLine(output []byte, n int) ([]byte, error) {
+	lines := strings.Split(strings.TrimSuffix(string(output), "\n"), "\n")
+	idx := n - 1
+	if n < 0 {
+		idx = len(lines) + n
+	}
+	if idx < 0 || idx >= len(lines) {
+		return nil, fmt.Errorf("output has %d lines, line %d cannot be selected", len(lines), n)
+	}
+	return []byte(strings.TrimSuffix(lines[idx], "\r")), nil
+}
+
+// selectField returns n-th field of output, fields are split by delimiter or by white characters
+func selectField(output []byte, n int, delimiter string) ([]byte, error) {
+	var fields []string
+	if delimiter == "" {
+		fields = strings.Fields(string(output))
+	} else {
+		fields = strings.Split(string(output), delimiter)
+	}
+	if n > len(fields) {
+		return nil, fmt.Errorf("output has %d fields, field %d cannot be selected", len(fields), n)
+	}
+	return []byte(fields[n-1]), nil
+}
+
+// extractMatch returns first capture group of regular expression or whole match if it has no groups
+func extractMatch(output []byte, expr string) ([]byte, error) {
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return nil, err
+	}
+	match := re.FindSubmatch(output)
+	if match == nil {
+		return nil, fmt.Errorf("output does not match %s", expr)
+	}
+	if len(match) > 1 {
+		return match[1], nil
+	}
+	return match[0], nil
+}
@@ -0,0 +1,169 @@
+// +build linux
+
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+
+Copyright 2016 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package collector
+
+import (
+	"testing"
+
+	"github.com/intelsdi-x/snap-plugin-lib-go/v1/plugin"
+	"github.com/intelsdi-x/snap/core/serror"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestValidateOutputSteps(t *testing.T) {
+	Convey("Validating steps of processing of output", t, func() {
+		So(validateOutputSteps(nil), ShouldBeNil)
+		So(validateOutputSteps([]outputStep{{Trim: true}, {Line: -1}, {Field: 2, Delimiter: ":"}, {Regex: `(\d+)`}}), ShouldBeNil)
+
+		err := validateOutputSteps([]outputStep{{}})
+		So(err, ShouldNotBeNil)
+		So(err.Error(), ShouldEqual, "step 0 of output must define exactly one of trim, line, field or regex")
+
+		err = validateOutputSteps([]outputStep{{Trim: true}, {Trim: true, Line: 1}})
+		So(err, ShouldNotBeNil)
+		So(err.Error(), ShouldEqual, "step 1 of output must define exactly one of trim, line, field or regex")
+
+		err = validateOutputSteps([]outputStep{{Field: -1}})
+		So(err, ShouldNotBeNil)
+		So(err.Error(), ShouldEqual, "field must be greater than 0 in step 0 of output")
+
+		err = validateOutputSteps([]outputStep{{Line: 1, Delimiter: ","}})
+		So(err, ShouldNotBeNil)
+		So(err.Error(), ShouldEqual, "delimiter can be used only with field in step 0 of output")
+
+		err = validateOutputSteps([]outputStep{{Regex: `(`}})
+		So(err, ShouldNotBeNil)
+		So(err.Error(), ShouldStartWith, "incorrect regex in step 0 of output")
+	})
+}
+
+func TestProcessOutput(t *testing.T) {
+	Convey("Processing output of metric", t, func() {
+		process := func(output string, steps ...outputStep) string {
+			processed, err := processOutput([]byte(output), steps)
+			So(err, ShouldBeNil)
+			return string(processed)
+		}
+
+		Convey("output without steps is not changed", func() {
+			So(process(" 65\n"), ShouldEqual, " 65\n")
+		})
+
+		Convey("white characters are trimmed", func() {
+			So(process(" \t65\r\n", outputStep{Trim: true}), ShouldEqual, "65")
+		})
+
+		Convey("lines are selected", func() {
+			output := "header\r\nfirst\r\nlast\r\n"
+			So(process(output, outputStep{Line: 1}), ShouldEqual, "header")
+			So(process(output, outputStep{Line: 2}), ShouldEqual, "first")
+			So(process(output, outputStep{Line: -1}), ShouldEqual, "last")
+			So(process("no newline", outputStep{Line: -1}), ShouldEqual, "no newline")
+
+			_, err := processOutput([]byte(output), []outputStep{{Line: 4}})
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldEqual, "Cannot process output in step 0, output has 3 lines, line 4 cannot be selected")
+			_, err = processOutput([]byte(output), []outputStep{{Line: -4}})
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("fields are selected", func() {
+			So(process("  /dev/sda1   100  42%\n", outputStep{Field: 3}), ShouldEqual, "42%")
+			So(process("test:1775", outputStep{Field: 2, Delimiter: ":"}), ShouldEqual, "1775")
+			So(process("a,,c", outputStep{Field: 2, Delimiter: ","}), ShouldEqual, "")
+
+			_, err := processOutput([]byte("a b"), []outputStep{{Field: 3}})
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldEqual, "Cannot process output in step 0, output has 2 fields, field 3 cannot be selected")
+		})
+
+		Convey("regular expressions extract values", func() {
+			So(process("load average: 0.52, 0.58", outputStep{Regex: `average: ([0-9.]+)`}), ShouldEqual, "0.52")
+			So(process("took 150ms", outputStep{Regex: `[0-9]+ms`}), ShouldEqual, "150ms")
+
+			_, err := processOutput([]byte("none"), []outputStep{{Trim: true}, {Regex: `\d+`}})
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldEqual, `Cannot process output in step 1, output does not match \d+`)
+		})
+
+		Convey("steps are applied in order", func() {
+			output := "Filesystem Use%\n/dev/sda1   42%\n"
+			So(process(output, outputStep{Line: -1}, outputStep{Field: 2}, outputStep{Regex: `(\d+)%`}), ShouldEqual, "42")
+		})
+	})
+}
+
+func TestCollectProcessedOutput(t *testing.T) {
+	Convey("Collecting metrics with processed output", t, func() {
+		createMockFile([]byte(`{
+			"used": {
+				"exec": "/bin/df",
+				"type": "int64",
+				"output": [{"line": -1}, {"field": 2}, {"regex": "(\\d+)%"}]
+			},
+			"unmatched": {
+				"exec": "/bin/df",
+				"type": "int64",
+				"output": [{"regex": "missing"}]
+			}
+		}`))
+		defer deleteMockFile()
+
+		config := plugin.Config{}
+		config[setFileConfigVar] = mockFilePath
+		config[execTimeOutConfigVar] = int64(10)
+
+		plg := New()
+		plg.cmd = func(cmd command) ([]byte, serror.SnapError) {
+			return []byte("Filesystem Use%\n/dev/sda1   42%\n"), nil
+		}
+		mts, err := plg.GetMetricTypes(config)
+		So(err, ShouldBeNil)
+		So(len(mts), ShouldEqual, 2)
+		So(plg.currentSetFile().metrics["used"].Output, ShouldResemble, []outputStep{{Line: -1}, {Field: 2}, {Regex: `(\d+)%`}})
+
+		Convey("value is extracted before conversion", func() {
+			results, err := plg.CollectMetrics([]plugin.Metric{{Namespace: plugin.NewNamespace(vendor, pluginName, "used"), Config: config}})
+			So(err, ShouldBeNil)
+			So(len(results), ShouldEqual, 1)
+			So(results[0].Data, ShouldEqual, int64(42))
+		})
+
+		Convey("metric is not collected when output cannot be processed", func() {
+			results, err := plg.CollectMetrics([]plugin.Metric{{Namespace: plugin.NewNamespace(vendor, pluginName, "unmatched"), Config: config}})
+			So(err, ShouldBeNil)
+			So(results, ShouldBeEmpty)
+		})
+
+		Convey("incorrect steps are reported", func() {
+			createMockFile([]byte(`{"used": {"exec": "/bin/df", "type": "int64", "output": [{"line": 1, "field": 2}]}}`))
+			_, err := New().GetMetricTypes(config)
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "step 0 of output must define exactly one of trim, line, field or regex for used")
+
+			createMockFile([]byte(`{"used": {"exec": "/bin/df", "type": "int64", "output": [{"lines": 1}]}}`))
+			_, err = New().GetMetricTypes(config)
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "unknown field lines (did you mean line?) in field output.0.lines of used")
+		})
+	})
+}
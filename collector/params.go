@@ -0,0 +1,167 @@
+// +build linux
+
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+
+Copyright 2016 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package collector
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+
+	"github.com/intelsdi-x/snap-plugin-lib-go/v1/plugin"
+)
+
+const (
+	//stringParam parameter of task config with string value
+	stringParam = "string"
+
+	//integerParam parameter of task config with integer value
+	integerParam = "integer"
+
+	//floatParam parameter of task config with floating point value
+	floatParam = "float"
+
+	//boolParam parameter of task config with boolean value
+	boolParam = "bool"
+)
+
+// paramTypes types of parameters of task config which can be declared in setfile
+var paramTypes = []string{stringParam, integerParam, floatParam, boolParam}
+
+// configParam parameter of task config declared by metric, e.g. a parameter referenced as ${config:port}
+type configParam struct {
+	Type     string      `json:"type,omitempty"`
+	Required bool        `json:"required,omitempty"`
+	Default  interface{} `json:"default,omitempty"`
+}
+
+// validateConfigParams checks declared parameters of task config and converts their default values
+// to types in which snap passes values of task config
+func validateConfigParams(params map[string]configParam) error {
+	for _, name := range sortedParams(params) {
+		param := params[name]
+		if param.Type == "" {
+			param.Type = stringParam
+		}
+		if !isParamType(param.Type) {
+			return fmt.Errorf("unsupported type %s of config parameter %s, expected one of %v", param.Type, name, paramTypes)
+		}
+		if param.Default != nil {
+			value, ok := paramValue(param.Type, param.Default)
+			if !ok {
+				return fmt.Errorf("default value of config parameter %s is not %s", name, param.Type)
+			}
+			param.Default = value
+		}
+		params[name] = param
+	}
+	return nil
+}
+
+func isParamType(paramType string) bool {
+	for _, t := range paramTypes {
+		if t == paramType {
+			return true
+		}
+	}
+	return false
+}
+
+func sortedParams(params map[string]configParam) []string {
+	names := make([]string, 0, len(params))
+	for name := range params {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// paramValue converts value to type of parameter, strings are parsed, so values can be given also on command line
+func paramValue(paramType string, value interface{}) (interface{}, bool) {
+	if s, ok := value.(string); ok && paramType != stringParam {
+		var err error
+		switch paramType {
+		case integerParam:
+			value, err = strconv.ParseInt(s, 10, 64)
+		case floatParam:
+			value, err = strconv.ParseFloat(s, 64)
+		case boolParam:
+			value, err = strconv.ParseBool(s)
+		}
+		if err != nil {
+			return nil, false
+		}
+	}
+
+	switch paramType {
+	case stringParam:
+		s, ok := value.(string)
+		return s, ok
+	case integerParam:
+		f, ok := toFloat(value)
+		if !ok || f != math.Trunc(f) {
+			return nil, false
+		}
+		if i, ok := value.(int64); ok {
+			return i, true
+		}
+		return int64(f), true
+	case floatParam:
+		f, ok := toFloat(value)
+		return f, ok
+	case boolParam:
+		b, ok := value.(bool)
+		return b, ok
+	}
+	return nil, false
+}
+
+// taskConfig returns task config of metric with default values of declared parameters,
+// missing required parameters and values of incorrect types are reported
+func (m metric) taskConfig(cfg plugin.Config) (plugin.Config, error) {
+	if len(m.Config) == 0 {
+		return cfg, nil
+	}
+	merged := plugin.Config{}
+	for k, v := range cfg {
+		merged[k] = v
+	}
+	for _, name := range sortedParams(m.Config) {
+		param := m.Config[name]
+		value, ok := merged[name]
+		if !ok {
+			if param.Required {
+				return nil, fmt.Errorf("Task config does not contain required parameter %s", name)
+			}
+			if param.Default != nil {
+				merged[name] = param.Default
+			}
+			continue
+		}
+		converted, ok := paramValue(param.Type, value)
+		if !ok {
+			return nil, fmt.Errorf("Incorrect value of config parameter %s, expected %s", name, param.Type)
+		}
+		merged[name] = converted
+	}
+	return merged, nil
+}
@@ -0,0 +1,148 @@
+// +build linux
+
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+
+Copyright 2016 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package collector
+
+import (
+	"testing"
+
+	"github.com/intelsdi-x/snap-plugin-lib-go/v1/plugin"
+	"github.com/intelsdi-x/snap/core/serror"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestValidateConfigParams(t *testing.T) {
+	Convey("Validating declared parameters of task config", t, func() {
+		Convey("type is string by default and default values are converted", func() {
+			params := map[string]configParam{
+				"db":      {Default: "main"},
+				"port":    {Type: integerParam, Default: 5432},
+				"ratio":   {Type: floatParam, Default: 1},
+				"verbose": {Type: boolParam, Default: true},
+			}
+			So(validateConfigParams(params), ShouldBeNil)
+			So(params["db"].Type, ShouldEqual, stringParam)
+			So(params["port"].Default, ShouldEqual, int64(5432))
+			So(params["ratio"].Default, ShouldEqual, float64(1))
+			So(params["verbose"].Default, ShouldEqual, true)
+		})
+
+		Convey("unsupported types are refused", func() {
+			err := validateConfigParams(map[string]configParam{"port": {Type: "int"}})
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "unsupported type int of config parameter port")
+		})
+
+		Convey("default values of incorrect types are refused", func() {
+			So(validateConfigParams(map[string]configParam{"port": {Type: integerParam, Default: 1.5}}), ShouldNotBeNil)
+			So(validateConfigParams(map[string]configParam{"db": {Default: 1}}), ShouldNotBeNil)
+		})
+	})
+}
+
+func TestTaskConfig(t *testing.T) {
+	Convey("Task config of metric", t, func() {
+		m := metric{Config: map[string]configParam{
+			"db":   {Type: stringParam, Required: true},
+			"port": {Type: integerParam, Default: int64(5432)},
+		}}
+
+		Convey("default values are added", func() {
+			cfg, err := m.taskConfig(plugin.Config{"db": "main"})
+			So(err, ShouldBeNil)
+			So(cfg, ShouldResemble, plugin.Config{"db": "main", "port": int64(5432)})
+		})
+
+		Convey("values given as strings are converted", func() {
+			cfg, err := m.taskConfig(plugin.Config{"db": "main", "port": "6432"})
+			So(err, ShouldBeNil)
+			So(cfg["port"], ShouldEqual, int64(6432))
+		})
+
+		Convey("missing required parameters are reported", func() {
+			_, err := m.taskConfig(plugin.Config{})
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "required parameter db")
+		})
+
+		Convey("values of incorrect types are reported", func() {
+			_, err := m.taskConfig(plugin.Config{"db": "main", "port": "x"})
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "expected integer")
+		})
+
+		Convey("config is unchanged if no parameters are declared", func() {
+			cfg := plugin.Config{"db": "main"}
+			merged, err := metric{}.taskConfig(cfg)
+			So(err, ShouldBeNil)
+			So(merged, ShouldResemble, cfg)
+		})
+	})
+}
+
+func TestConfigParams(t *testing.T) {
+	Convey("Collecting metrics with declared parameters", t, func() {
+		createMockFile(mockFileContParams)
+		defer deleteMockFile()
+
+		config := plugin.Config{}
+		config[setFileConfigVar] = mockFilePath
+		config[execTimeOutConfigVar] = int64(10)
+
+		plg := New()
+		plg.cmd = mockExecuteCmd
+
+		mts, err := plg.GetMetricTypes(config)
+		So(err, ShouldBeNil)
+		So(len(mts), ShouldEqual, 1)
+
+		Convey("metric is collected with default values of parameters", func() {
+			var executed command
+			plg.cmd = func(cmd command) ([]byte, serror.SnapError) {
+				executed = cmd
+				return []byte("1"), nil
+			}
+			results, err := plg.CollectMetrics([]plugin.Metric{{Namespace: mts[0].Namespace, Config: config}})
+			So(err, ShouldBeNil)
+			So(len(results), ShouldEqual, 1)
+			So(executed.args, ShouldResemble, []string{"main", "5432"})
+		})
+
+		Convey("incorrect declarations are reported", func() {
+			createMockFile([]byte(`{"size": {"exec": "/bin/echo", "type": "int64", "config": {"port": {"type": "integer", "default": "x"}}}}`))
+			_, err := New().GetMetricTypes(config)
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "default value of config parameter port is not integer")
+		})
+	})
+}
+
+var mockFileContParams = []byte(`{
+	"size": {
+		"exec": "/bin/echo",
+		"type": "int64",
+		"args": ["${config:db}", "${config:port}"],
+		"config": {
+			"db": {"default": "main"},
+			"port": {"type": "integer", "default": 5432}
+		}
+	}
+}`)
@@ -0,0 +1,295 @@
+// +build linux
+
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+
+Copyright 2016 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package collector
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/intelsdi-x/snap-plugin-lib-go/v1/plugin"
+)
+
+const (
+	//valueOutputFormat output of metric is a single value, it is the default format
+	valueOutputFormat = "value"
+
+	//kvOutputFormat output of metric consists of key: value lines, each key is a separate metric
+	kvOutputFormat = "kv"
+
+	//tableOutputFormat output of metric is a table with header row, each row and selected column is a separate metric
+	tableOutputFormat = "table"
+
+	//defaultKVSeparator separator of keys and values in kv format
+	defaultKVSeparator = ":"
+
+	//keyElementName name of dynamic element of namespace which holds key of value
+	keyElementName = "key"
+)
+
+// keyReplacer replaces characters of keys which are not allowed in elements of namespace
+var keyReplacer = strings.NewReplacer(namespaceSeparator, "_", "*", "_")
+
+// parsedValue single value found in output of metric
+type parsedValue struct {
+	key  string //key of value in kv and table formats, used as dynamic element of namespace
+	data []byte
+}
+
+// multiValue returns true if metric produces multiple values from one execution
+func (m metric) multiValue() bool {
+	return m.Format == kvOutputFormat || m.Format == tableOutputFormat
+}
+
+// valueType returns data type of values of metric, in table format each column can have its own type
+func (m metric) valueType(column string) string {
+	if t := m.Columns[column]; t != "" {
+		return t
+	}
+	return m.Type
+}
+
+// valueTypes returns all data types of values of metric
+func (m metric) valueTypes() []string {
+	if m.Format != tableOutputFormat {
+		return []string{m.Type}
+	}
+	types := []string{}
+	for _, column := range m.sortedColumns() {
+		types = append(types, m.valueType(column))
+	}
+	return types
+}
+
+func (m metric) sortedColumns() []string {
+	columns := make([]string, 0, len(m.Columns))
+	for column := range m.Columns {
+		columns = append(columns, column)
+	}
+	sort.Strings(columns)
+	return columns
+}
+
+// keyElement returns name of dynamic element of namespace of metric in kv and table formats
+func (m metric) keyElement() string {
+	if m.Format == tableOutputFormat && m.KeyColumn != "" {
+		return strings.ToLower(m.KeyColumn)
+	}
+	return keyElementName
+}
+
+// catalogEntries returns metrics published for metric defined in setfile, in kv format the key of value
+// is dynamic element of namespace, in table format the key is followed by name of column
+func (m metric) catalogEntries(name string, prefix []string) []catalogEntry {
+	ns := m.namespace(name, prefix)
+	switch m.Format {
+	case kvOutputFormat:
+		return []catalogEntry{{name: name, namespace: ns.AddDynamicElement(keyElementName, "Key of value in output")}}
+	case tableOutputFormat:
+		keyColumn := m.KeyColumn
+		if keyColumn == "" {
+			keyColumn = "the first column"
+		}
+		entries := []catalogEntry{}
+		for _, column := range m.sortedColumns() {
+			entries = append(entries, catalogEntry{
+				name:      name,
+				column:    column,
+				namespace: ns.AddDynamicElement(m.keyElement(), fmt.Sprintf("Value of %s in row", keyColumn)).AddStaticElement(column),
+			})
+		}
+		return entries
+	}
+	return []catalogEntry{{name: name, namespace: ns}}
+}
+
+// validateOutputFormat checks format of output of metric and options of parsing which are used with it
+func validateOutputFormat(m metric) error {
+	switch m.Format {
+	case "", valueOutputFormat, kvOutputFormat, tableOutputFormat:
+	default:
+		return fmt.Errorf("unsupported format %s, expected %s, %s or %s", m.Format, valueOutputFormat, kvOutputFormat, tableOutputFormat)
+	}
+	if m.Separator != "" && m.Format != kvOutputFormat {
+		return fmt.Errorf("separator can be used only with format %s", kvOutputFormat)
+	}
+	if m.Format != tableOutputFormat {
+		if m.KeyColumn != "" || len(m.Columns) > 0 || len(m.Header) > 0 {
+			return fmt.Errorf("key_column, columns and header can be used only with format %s", tableOutputFormat)
+		}
+		return nil
+	}
+
+	if len(m.Columns) == 0 {
+		return fmt.Errorf("columns must be defined with format %s", tableOutputFormat)
+	}
+	for _, column := range m.sortedColumns() {
+		if err := validateNamespaceElements([]string{column}); err != nil {
+			return fmt.Errorf("incorrect name of column %s, %v", column, err)
+		}
+		if column == m.KeyColumn {
+			return fmt.Errorf("key column %s cannot be selected in columns", column)
+		}
+		if t := m.Columns[column]; t != "" && !isSupportedType(t) {
+			return fmt.Errorf("unsupported type %s of column %s, expected one of %s", t, column, strings.Join(supportedTypes, ", "))
+		}
+	}
+	if len(m.Header) > 0 {
+		for _, column := range append(m.sortedColumns(), m.KeyColumn) {
+			if column != "" && indexOf(m.Header, column) < 0 {
+				return fmt.Errorf("column %s is not defined in header", column)
+			}
+		}
+	}
+	return nil
+}
+
+// parseValues returns values found in output of metric, in table format values of given column are returned
+func (m metric) parseValues(output []byte, column string) ([]parsedValue, error) {
+	switch m.Format {
+	case kvOutputFormat:
+		separator := m.Separator
+		if separator == "" {
+			separator = defaultKVSeparator
+		}
+		return parseKV(output, separator), nil
+	case tableOutputFormat:
+		return parseTable(output, m.Header, m.KeyColumn, column)
+	}
+	return []parsedValue{{data: output}}, nil
+}
+
+// parseKV returns values of lines in format key<separator>value, lines without separator are skipped
+// and only the first value of repeated key is returned
+func parseKV(output []byte, separator string) []parsedValue {
+	values := []parsedValue{}
+	seen := map[string]bool{}
+	for _, line := range strings.Split(string(output), "\n") {
+		idx := strings.Index(line, separator)
+		if idx < 0 {
+			continue
+		}
+		key := keyReplacer.Replace(strings.TrimSpace(line[:idx]))
+		if key == "" || seen[key] {
+			continue
+		}
+		seen[key] = true
+		values = append(values, parsedValue{key: key, data: []byte(strings.TrimSpace(line[idx+len(separator):]))})
+	}
+	return values
+}
+
+// parseTable returns values of column in rows of table, names of columns are read from the first line of output
+// or defined by header, by default the first column is the key of rows
+func parseTable(output []byte, header []string, keyColumn string, column string) ([]parsedValue, error) {
+	lines := []string{}
+	for _, line := range strings.Split(string(output), "\n") {
+		if strings.TrimSpace(line) != "" {
+			lines = append(lines, line)
+		}
+	}
+	if len(lines) == 0 {
+		return nil, fmt.Errorf("Output does not contain header of table")
+	}
+	names := header
+	if len(names) == 0 {
+		names = strings.Fields(lines[0])
+	}
+
+	keyIdx := 0
+	if keyColumn != "" {
+		if keyIdx = indexOf(names, keyColumn); keyIdx < 0 {
+			return nil, fmt.Errorf("Column %s not found in header of table", keyColumn)
+		}
+	}
+	valueIdx := indexOf(names, column)
+	if valueIdx < 0 {
+		return nil, fmt.Errorf("Column %s not found in header of table", column)
+	}
+
+	values := []parsedValue{}
+	seen := map[string]bool{}
+	for _, line := range lines[1:] {
+		fields := splitColumns(line, len(names))
+		if keyIdx >= len(fields) || valueIdx >= len(fields) {
+			continue
+		}
+		key := keyReplacer.Replace(fields[keyIdx])
+		if key == "" || seen[key] {
+			continue
+		}
+		seen[key] = true
+		values = append(values, parsedValue{key: key, data: []byte(fields[valueIdx])})
+	}
+	return values, nil
+}
+
+// splitColumns splits line of table into at most n fields separated by white characters,
+// the last field contains the rest of line, e.g. mount point with spaces
+func splitColumns(line string, n int) []string {
+	fields := []string{}
+	rest := strings.TrimSpace(line)
+	for rest != "" && len(fields) < n-1 {
+		idx := strings.IndexFunc(rest, unicode.IsSpace)
+		if idx < 0 {
+			break
+		}
+		fields = append(fields, rest[:idx])
+		rest = strings.TrimLeftFunc(rest[idx:], unicode.IsSpace)
+	}
+	if rest != "" {
+		fields = append(fields, rest)
+	}
+	return fields
+}
+
+// withKey returns copy of namespace with value of dynamic element set to key
+func withKey(ns plugin.Namespace, key string) plugin.Namespace {
+	concrete := make(plugin.Namespace, len(ns))
+	copy(concrete, ns)
+	for i := range concrete {
+		if concrete[i].IsDynamic() {
+			concrete[i].Value = key
+		}
+	}
+	return concrete
+}
+
+// requestedKey returns value of dynamic element of requested namespace, it is empty when all keys are requested
+func requestedKey(entry plugin.Namespace, requested plugin.Namespace) string {
+	for i := range entry {
+		if entry[i].IsDynamic() && i < len(requested) && requested[i].Value != "*" {
+			return requested[i].Value
+		}
+	}
+	return ""
+}
+
+func indexOf(items []string, item string) int {
+	for i, s := range items {
+		if s == item {
+			return i
+		}
+	}
+	return -1
+}
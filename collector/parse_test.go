@@ -0,0 +1,278 @@
+// +build linux
+
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+
+Copyright 2016 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package collector
+
+import (
+	"sync/atomic"
+	"testing"
+
+	"github.com/intelsdi-x/snap-plugin-lib-go/v1/plugin"
+	"github.com/intelsdi-x/snap/core/serror"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+const mockSysctlOutput = `kernel.hostname = node1
+kernel.pid_max = 32768
+vm.swappiness = 60
+vm.swappiness = 10
+net/ipv4/ip_forward = 1
+not a key value line
+`
+
+const mockDfOutput = `Filesystem     1024-blocks      Used Available Capacity Mounted on
+/dev/sda1         41152736  17194364  21845036      45% /
+tmpfs              8192000         0   8192000       0% /mnt/my data
+`
+
+func TestParseKV(t *testing.T) {
+	Convey("Parsing key-value output", t, func() {
+		values := parseKV([]byte(mockSysctlOutput), "=")
+		So(values, ShouldResemble, []parsedValue{
+			{key: "kernel.hostname", data: []byte("node1")},
+			{key: "kernel.pid_max", data: []byte("32768")},
+			{key: "vm.swappiness", data: []byte("60")},
+			{key: "net_ipv4_ip_forward", data: []byte("1")},
+		})
+
+		values = parseKV([]byte("MemTotal:       16316412 kB\nMemFree:  1024 kB\n: 5\n"), ":")
+		So(values, ShouldResemble, []parsedValue{
+			{key: "MemTotal", data: []byte("16316412 kB")},
+			{key: "MemFree", data: []byte("1024 kB")},
+		})
+	})
+}
+
+func TestParseTable(t *testing.T) {
+	Convey("Parsing table output", t, func() {
+		Convey("names of columns are read from the first line", func() {
+			values, err := parseTable([]byte(mockDfOutput), nil, "", "Used")
+			So(err, ShouldBeNil)
+			So(values, ShouldResemble, []parsedValue{
+				{key: "_dev_sda1", data: []byte("17194364")},
+				{key: "tmpfs", data: []byte("0")},
+			})
+		})
+
+		Convey("names of columns can be defined by header", func() {
+			header := []string{"filesystem", "blocks", "used", "available", "capacity", "mount"}
+			values, err := parseTable([]byte(mockDfOutput), header, "mount", "capacity")
+			So(err, ShouldBeNil)
+			So(values, ShouldResemble, []parsedValue{
+				{key: "_", data: []byte("45%")},
+				{key: "_mnt_my data", data: []byte("0%")},
+			})
+		})
+
+		Convey("rows without key or value are skipped", func() {
+			values, err := parseTable([]byte("NAME SIZE MOUNT\nsda 100\n\nsdb\nsda 200 /\n"), nil, "", "SIZE")
+			So(err, ShouldBeNil)
+			So(values, ShouldResemble, []parsedValue{{key: "sda", data: []byte("100")}})
+		})
+
+		Convey("unknown columns are reported", func() {
+			_, err := parseTable([]byte(mockDfOutput), nil, "", "Size")
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldEqual, "Column Size not found in header of table")
+
+			_, err = parseTable([]byte(mockDfOutput), nil, "Device", "Used")
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldEqual, "Column Device not found in header of table")
+
+			_, err = parseTable([]byte("\n"), nil, "", "Used")
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldEqual, "Output does not contain header of table")
+		})
+
+		Convey("the last column contains the rest of line", func() {
+			So(splitColumns("  a  b   c d ", 3), ShouldResemble, []string{"a", "b", "c d"})
+			So(splitColumns("a b", 3), ShouldResemble, []string{"a", "b"})
+			So(splitColumns("a\tb c", 1), ShouldResemble, []string{"a\tb c"})
+			So(splitColumns("   ", 3), ShouldBeEmpty)
+		})
+	})
+}
+
+func TestValidateOutputFormat(t *testing.T) {
+	Convey("Validating format of output", t, func() {
+		So(validateOutputFormat(metric{}), ShouldBeNil)
+		So(validateOutputFormat(metric{Format: valueOutputFormat}), ShouldBeNil)
+		So(validateOutputFormat(metric{Format: kvOutputFormat, Separator: "="}), ShouldBeNil)
+		So(validateOutputFormat(metric{Format: tableOutputFormat, KeyColumn: "NAME", Columns: map[string]string{"SIZE": "bytes", "RO": ""}}), ShouldBeNil)
+
+		for m, message := range map[*metric]string{
+			&metric{Format: "csv"}:                             "unsupported format csv, expected value, kv or table",
+			&metric{Separator: "="}:                            "separator can be used only with format kv",
+			&metric{Format: kvOutputFormat, KeyColumn: "NAME"}: "key_column, columns and header can be used only with format table",
+			&metric{Format: tableOutputFormat}:                 "columns must be defined with format table",
+			&metric{Format: tableOutputFormat, Columns: map[string]string{"buff/cache": ""}}:                                               "incorrect name of column buff/cache, elements of namespace cannot contain / or *, got buff/cache",
+			&metric{Format: tableOutputFormat, KeyColumn: "NAME", Columns: map[string]string{"NAME": ""}}:                                  "key column NAME cannot be selected in columns",
+			&metric{Format: tableOutputFormat, Columns: map[string]string{"SIZE": "size"}}:                                                 "unsupported type size of column SIZE, expected one of float64, float32, int64, int32, int16, int8, uint64, uint32, uint16, uint8, string, bool, duration, bytes, timestamp",
+			&metric{Format: tableOutputFormat, Header: []string{"name", "size"}, Columns: map[string]string{"used": ""}}:                   "column used is not defined in header",
+			&metric{Format: tableOutputFormat, Header: []string{"name", "size"}, KeyColumn: "dev", Columns: map[string]string{"size": ""}}: "column dev is not defined in header",
+		} {
+			err := validateOutputFormat(*m)
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldEqual, message)
+		}
+	})
+}
+
+func TestCollectMultipleValues(t *testing.T) {
+	Convey("Collecting metrics with multiple values", t, func() {
+		createMockFile([]byte(`{
+			"sysctl": {"exec": "/sbin/sysctl", "type": "int64", "format": "kv", "separator": "="},
+			"df": {
+				"exec": "/bin/df",
+				"type": "uint64",
+				"format": "table",
+				"header": ["filesystem", "blocks", "used", "available", "capacity", "mount"],
+				"key_column": "mount",
+				"columns": {"used": "", "capacity": "string"}
+			}
+		}`))
+		defer deleteMockFile()
+
+		config := plugin.Config{}
+		config[setFileConfigVar] = mockFilePath
+		config[execTimeOutConfigVar] = int64(10)
+
+		plg := New()
+		plg.cmd = func(cmd command) ([]byte, serror.SnapError) {
+			if cmd.path == "/bin/df" {
+				return []byte(mockDfOutput), nil
+			}
+			return []byte(mockSysctlOutput), nil
+		}
+		mts, err := plg.GetMetricTypes(config)
+		So(err, ShouldBeNil)
+		namespaces := []string{}
+		for _, mt := range mts {
+			namespaces = append(namespaces, mt.Namespace.String())
+		}
+		So(namespaces, ShouldContain, "/intel/exec/sysctl/*")
+		So(namespaces, ShouldContain, "/intel/exec/df/*/used")
+		So(namespaces, ShouldContain, "/intel/exec/df/*/capacity")
+		So(len(mts), ShouldEqual, 3)
+
+		sysctl := plugin.NewNamespace(vendor, pluginName, "sysctl").AddDynamicElement(keyElementName, "Key of value in output")
+		used := plugin.NewNamespace(vendor, pluginName, "df").AddDynamicElement("mount", "").AddStaticElement("used")
+
+		Convey("values of all keys are collected, values of other types are skipped", func() {
+			results, err := plg.CollectMetrics([]plugin.Metric{{Namespace: sysctl, Config: config}})
+			So(err, ShouldBeNil)
+			So(len(results), ShouldEqual, 3)
+			So(results[0].Namespace.String(), ShouldEqual, "/intel/exec/sysctl/kernel.pid_max")
+			So(results[0].Namespace[3].Name, ShouldEqual, keyElementName)
+			So(results[0].Data, ShouldEqual, int64(32768))
+			So(results[1].Namespace.String(), ShouldEqual, "/intel/exec/sysctl/vm.swappiness")
+			So(results[2].Namespace.String(), ShouldEqual, "/intel/exec/sysctl/net_ipv4_ip_forward")
+		})
+
+		Convey("value of requested key is collected", func() {
+			requested := plugin.NewNamespace(vendor, pluginName, "sysctl", "vm.swappiness")
+			results, err := plg.CollectMetrics([]plugin.Metric{{Namespace: requested, Config: config}})
+			So(err, ShouldBeNil)
+			So(len(results), ShouldEqual, 1)
+			So(results[0].Data, ShouldEqual, int64(60))
+
+			collected, serr := plg.collect([]plugin.Metric{{Namespace: plugin.NewNamespace(vendor, pluginName, "sysctl", "kernel.hostname"), Config: config}})
+			So(serr, ShouldBeNil)
+			So(collected[0].err, ShouldNotBeNil)
+
+			collected, serr = plg.collect([]plugin.Metric{{Namespace: plugin.NewNamespace(vendor, pluginName, "sysctl", "vm.dirty_ratio"), Config: config}})
+			So(serr, ShouldBeNil)
+			So(collected[0].err, ShouldNotBeNil)
+			So(collected[0].err.Error(), ShouldEqual, "Key vm.dirty_ratio not found in output")
+		})
+
+		Convey("columns of table have their own types", func() {
+			results, err := plg.CollectMetrics([]plugin.Metric{{Namespace: used, Config: config}})
+			So(err, ShouldBeNil)
+			So(len(results), ShouldEqual, 2)
+			So(results[0].Namespace.String(), ShouldEqual, "/intel/exec/df/_/used")
+			So(results[0].Data, ShouldEqual, uint64(17194364))
+			So(results[1].Namespace.String(), ShouldEqual, "/intel/exec/df/_mnt_my data/used")
+
+			capacity := plugin.NewNamespace(vendor, pluginName, "df").AddDynamicElement("mount", "").AddStaticElement("capacity")
+			results, err = plg.CollectMetrics([]plugin.Metric{{Namespace: capacity, Config: config}})
+			So(err, ShouldBeNil)
+			So(len(results), ShouldEqual, 2)
+			So(results[0].Data, ShouldEqual, "45%")
+		})
+
+		Convey("columns of table are collected from single execution", func() {
+			var executions int32
+			plg.cmd = func(cmd command) ([]byte, serror.SnapError) {
+				atomic.AddInt32(&executions, 1)
+				return []byte(mockDfOutput), nil
+			}
+			capacity := plugin.NewNamespace(vendor, pluginName, "df").AddDynamicElement("mount", "").AddStaticElement("capacity")
+			results, err := plg.CollectMetrics([]plugin.Metric{{Namespace: used, Config: config}, {Namespace: capacity, Config: config}})
+			So(err, ShouldBeNil)
+			So(atomic.LoadInt32(&executions), ShouldEqual, 1)
+			So(len(results), ShouldEqual, 4)
+			So(results[0].Data, ShouldEqual, uint64(17194364))
+			So(results[2].Data, ShouldEqual, "45%")
+
+			Convey("unless they are requested with different config", func() {
+				other := plugin.Config{}
+				for k, v := range config {
+					other[k] = v
+				}
+				other[execTimeOutConfigVar] = int64(20)
+				_, err := plg.CollectMetrics([]plugin.Metric{{Namespace: used, Config: config}, {Namespace: capacity, Config: other}})
+				So(err, ShouldBeNil)
+				So(atomic.LoadInt32(&executions), ShouldEqual, 3)
+			})
+		})
+
+				Convey("keys are exposed in labels", func() {
+			requested := []plugin.Metric{{Namespace: used, Config: config}}
+			results, serr := plg.collect(requested)
+			So(serr, ShouldBeNil)
+			body := string(renderExposition(requested, results, plg.currentSetFile().metrics))
+			So(body, ShouldContainSubstring, "# TYPE intel_exec_df_used gauge\n")
+			So(body, ShouldContainSubstring, "intel_exec_df_used{mount=\"_\"} 17194364\n")
+			So(body, ShouldContainSubstring, "intel_exec_df_used{mount=\"_mnt_my data\"} 0\n")
+		})
+
+		Convey("rates are computed for each key", func() {
+			createMockFile([]byte(`{"sysctl": {"exec": "/sbin/sysctl", "type": "int64", "format": "kv", "separator": "=", "kind": "counter"}}`))
+			_, err := plg.GetMetricTypes(config)
+			So(err, ShouldBeNil)
+			results, err := plg.CollectMetrics([]plugin.Metric{{Namespace: sysctl, Config: config}})
+			So(err, ShouldBeNil)
+			So(results, ShouldBeEmpty)
+			results, err = plg.CollectMetrics([]plugin.Metric{{Namespace: sysctl, Config: config}})
+			So(err, ShouldBeNil)
+			So(len(results), ShouldEqual, 3)
+			So(results[0].Data, ShouldEqual, float64(0))
+		})
+
+		Convey("expression is checked against types of columns", func() {
+			createMockFile([]byte(`{"df": {"exec": "/bin/df", "type": "uint64", "format": "table", "columns": {"Used": "", "Capacity": "string"}, "expression": "value * 1024"}}`))
+			_, err := New().GetMetricTypes(config)
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "expression cannot be used with type string, only with numeric types for df")
+		})
+	})
+}
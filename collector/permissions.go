@@ -0,0 +1,110 @@
+// +build linux
+
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+
+Copyright 2016 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package collector
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"syscall"
+)
+
+// checkPermissions verifies that file can be safely loaded or executed by plugin,
+// it returns error when the file, any of its parent directories or any symlink
+// on the way to it can be modified by someone else than root or owner of plugin process
+func checkPermissions(path string) error {
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return err
+	}
+
+	if err := checkPath(absPath); err != nil {
+		return err
+	}
+
+	resolvedPath, err := filepath.EvalSymlinks(absPath)
+	if err != nil {
+		return err
+	}
+
+	if resolvedPath != absPath {
+		//path is reached via symlink, check also its target
+		return checkPath(resolvedPath)
+	}
+	return nil
+}
+
+// checkPath checks path and all its parent directories, symlinks are not followed
+func checkPath(path string) error {
+	for {
+		fi, err := os.Lstat(path)
+		if err != nil {
+			return err
+		}
+		if err := checkFileInfo(path, fi); err != nil {
+			return err
+		}
+
+		parent := filepath.Dir(path)
+		if parent == path {
+			return nil
+		}
+		path = parent
+	}
+}
+
+// checkFileInfo checks ownership and mode of single file, directory or symlink
+func checkFileInfo(path string, fi os.FileInfo) error {
+	st, ok := fi.Sys().(*syscall.Stat_t)
+	if !ok {
+		return fmt.Errorf("Cannot read ownership of %s", path)
+	}
+
+	if st.Uid != 0 && int(st.Uid) != os.Geteuid() {
+		return fmt.Errorf("%s is owned by uid %d, expected root or uid %d", path, st.Uid, os.Geteuid())
+	}
+
+	if fi.Mode()&os.ModeSymlink != 0 {
+		//permissions of symlink are not used, only its owner matters
+		return nil
+	}
+
+	//directories with sticky bit (e.g. /tmp) do not allow others to replace files which they do not own
+	if fi.IsDir() && fi.Mode()&os.ModeSticky != 0 {
+		return nil
+	}
+
+	perm := fi.Mode().Perm()
+	if perm&0002 != 0 {
+		return fmt.Errorf("%s is world-writable", path)
+	}
+	if perm&0020 != 0 && !isTrustedGroup(st.Gid) {
+		return fmt.Errorf("%s is group-writable by untrusted group %d", path, st.Gid)
+	}
+
+	return nil
+}
+
+// isTrustedGroup returns true for root group and effective group of plugin process
+func isTrustedGroup(gid uint32) bool {
+	return gid == 0 || int(gid) == os.Getegid()
+}
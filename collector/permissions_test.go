@@ -0,0 +1,79 @@
+// +build linux
+
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+
+Copyright 2016 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package collector
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestCheckPermissions(t *testing.T) {
+	Convey("Checking permissions of files", t, func() {
+		dir, err := ioutil.TempDir("", "exec-permissions")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+
+		file := filepath.Join(dir, "setfile.json")
+		So(ioutil.WriteFile(file, []byte("{}"), 0600), ShouldBeNil)
+
+		Convey("when file is protected", func() {
+			So(checkPermissions(file), ShouldBeNil)
+		})
+
+		Convey("when file does not exist", func() {
+			So(checkPermissions(filepath.Join(dir, "missing.json")), ShouldNotBeNil)
+		})
+
+		Convey("when file is world-writable", func() {
+			os.Chmod(file, 0602)
+			So(checkPermissions(file), ShouldNotBeNil)
+		})
+
+		Convey("when parent directory is world-writable", func() {
+			os.Chmod(dir, 0777)
+			So(checkPermissions(file), ShouldNotBeNil)
+		})
+
+		Convey("when parent directory is world-writable with sticky bit", func() {
+			os.Chmod(dir, 0777|os.ModeSticky)
+			So(checkPermissions(file), ShouldBeNil)
+		})
+
+		Convey("when file is reached via symlink", func() {
+			link := filepath.Join(dir, "link.json")
+			So(os.Symlink(file, link), ShouldBeNil)
+
+			Convey("and target is protected", func() {
+				So(checkPermissions(link), ShouldBeNil)
+			})
+
+			Convey("and target is world-writable", func() {
+				os.Chmod(file, 0666)
+				So(checkPermissions(link), ShouldNotBeNil)
+			})
+		})
+	})
+}
@@ -0,0 +1,189 @@
+// +build linux
+
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+
+Copyright 2016 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package collector
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// position location of key in setfile
+type position struct {
+	file   string
+	line   int
+	column int
+}
+
+func (p position) String() string {
+	if p.line == 0 {
+		return p.file
+	}
+	return fmt.Sprintf("%s:%d:%d", p.file, p.line, p.column)
+}
+
+// keyPath identifies nested key in setfile, e.g. keyPath("metric0", "args", "1")
+func keyPath(elems ...string) string {
+	return strings.Join(elems, ".")
+}
+
+// jsonKeyPositions returns positions of all object keys and array elements in JSON document,
+// positions are identified by keyPath of the element, scanning stops at the first syntax error
+func jsonKeyPositions(file string, content []byte) map[string]position {
+	s := &jsonScanner{data: content, line: 1, column: 1, file: file, positions: map[string]position{}}
+	s.value(nil)
+	return s.positions
+}
+
+// jsonScanner tracks line and column while walking through JSON document
+type jsonScanner struct {
+	data      []byte
+	i         int
+	line      int
+	column    int
+	file      string
+	positions map[string]position
+}
+
+func (s *jsonScanner) position() position {
+	return position{file: s.file, line: s.line, column: s.column}
+}
+
+func (s *jsonScanner) advance() {
+	if s.data[s.i] == '\n' {
+		s.line++
+		s.column = 1
+	} else {
+		s.column++
+	}
+	s.i++
+}
+
+func (s *jsonScanner) skipSpace() {
+	for s.i < len(s.data) && strings.IndexByte(" \t\r\n", s.data[s.i]) >= 0 {
+		s.advance()
+	}
+}
+
+// consume skips white characters and expected character, it returns false if other character is found
+func (s *jsonScanner) consume(c byte) bool {
+	s.skipSpace()
+	if s.i >= len(s.data) || s.data[s.i] != c {
+		return false
+	}
+	s.advance()
+	return true
+}
+
+func (s *jsonScanner) value(path []string) bool {
+	s.skipSpace()
+	if s.i >= len(s.data) {
+		return false
+	}
+	switch s.data[s.i] {
+	case '{':
+		return s.object(path)
+	case '[':
+		return s.array(path)
+	case '"':
+		_, ok := s.str()
+		return ok
+	default:
+		for s.i < len(s.data) && strings.IndexByte(",]} \t\r\n", s.data[s.i]) < 0 {
+			s.advance()
+		}
+		return true
+	}
+}
+
+func (s *jsonScanner) object(path []string) bool {
+	s.advance()
+	if s.consume('}') {
+		return true
+	}
+	for {
+		s.skipSpace()
+		pos := s.position()
+		key, ok := s.str()
+		if !ok || !s.consume(':') {
+			return false
+		}
+		keyPathElems := append(append([]string{}, path...), key)
+		s.positions[keyPath(keyPathElems...)] = pos
+		if !s.value(keyPathElems) {
+			return false
+		}
+		if s.consume('}') {
+			return true
+		}
+		if !s.consume(',') {
+			return false
+		}
+	}
+}
+
+func (s *jsonScanner) array(path []string) bool {
+	s.advance()
+	if s.consume(']') {
+		return true
+	}
+	for idx := 0; ; idx++ {
+		s.skipSpace()
+		elemPath := append(append([]string{}, path...), strconv.Itoa(idx))
+		s.positions[keyPath(elemPath...)] = s.position()
+		if !s.value(elemPath) {
+			return false
+		}
+		if s.consume(']') {
+			return true
+		}
+		if !s.consume(',') {
+			return false
+		}
+	}
+}
+
+// str reads JSON string and returns its decoded value
+func (s *jsonScanner) str() (string, bool) {
+	if s.i >= len(s.data) || s.data[s.i] != '"' {
+		return "", false
+	}
+	start := s.i
+	s.advance()
+	for s.i < len(s.data) && s.data[s.i] != '"' {
+		if s.data[s.i] == '\\' && s.i+1 < len(s.data) {
+			s.advance()
+		}
+		s.advance()
+	}
+	if s.i >= len(s.data) {
+		return "", false
+	}
+	s.advance()
+
+	var value string
+	if err := json.Unmarshal(s.data[start:s.i], &value); err != nil {
+		return "", false
+	}
+	return value, true
+}
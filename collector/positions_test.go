@@ -0,0 +1,53 @@
+// +build linux
+
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+
+Copyright 2016 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package collector
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestJSONKeyPositions(t *testing.T) {
+	Convey("Finding positions of keys in JSON document", t, func() {
+		content := []byte(`{
+  "metric0": {
+    "exec": "/bin/sh",
+    "args": ["-c", "echo \"}\""]
+  },
+  "metric1": {"type": "int64", "ok": true, "n": -1.5e3}
+}`)
+		positions := jsonKeyPositions("setfile.json", content)
+
+		So(positions[keyPath("metric0")], ShouldResemble, position{file: "setfile.json", line: 2, column: 3})
+		So(positions[keyPath("metric0", "exec")], ShouldResemble, position{file: "setfile.json", line: 3, column: 5})
+		So(positions[keyPath("metric0", "args", "1")], ShouldResemble, position{file: "setfile.json", line: 4, column: 20})
+		So(positions[keyPath("metric1")], ShouldResemble, position{file: "setfile.json", line: 6, column: 3})
+		So(positions[keyPath("metric1", "n")], ShouldResemble, position{file: "setfile.json", line: 6, column: 44})
+		So(positions[keyPath("metric0")].String(), ShouldEqual, "setfile.json:2:3")
+
+		Convey("when document is incorrect, keys before error are found", func() {
+			positions := jsonKeyPositions("setfile.json", []byte(`{"metric0": {"exec": }`))
+			So(positions, ShouldContainKey, keyPath("metric0", "exec"))
+		})
+	})
+}
@@ -0,0 +1,177 @@
+// +build linux
+
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+
+Copyright 2016 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package collector
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/intelsdi-x/snap-plugin-lib-go/v1/plugin"
+)
+
+const (
+	//gaugeKind value of metric is collected as it is, it is the default kind
+	gaugeKind = "gauge"
+
+	//counterKind value of metric is monotonic counter, its per-second rate is collected
+	counterKind = "counter"
+
+	//deriveKind value of metric can increase and decrease, its per-second rate of change is collected
+	deriveKind = "derive"
+
+	//deltaKind value of metric can increase and decrease, its change since previous sample is collected
+	deltaKind = "delta"
+
+	//staleSampleIntervals number of intervals of metric after which its sample which was not updated is removed
+	staleSampleIntervals = 5
+
+	//staleSampleTimeout time after which sample of metric whose interval is not known yet is removed
+	staleSampleTimeout = 24 * time.Hour
+
+	//sampleSweepInterval min time between removals of stale samples
+	sampleSweepInterval = time.Minute
+)
+
+// counterMax max values of counters of data types which wrap around
+var counterMax = map[string]float64{
+	"int64":  math.MaxInt64,
+	"int32":  math.MaxInt32,
+	"int16":  math.MaxInt16,
+	"int8":   math.MaxInt8,
+	"uint64": math.MaxUint64,
+	"uint32": math.MaxUint32,
+	"uint16": math.MaxUint16,
+	"uint8":  math.MaxUint8,
+	"bytes":  math.MaxUint64,
+}
+
+// validateKind checks that kind of metric is supported and can be used with its data type
+func validateKind(kind string, dataType string) error {
+	switch kind {
+	case "", gaugeKind:
+		return nil
+	case counterKind, deriveKind, deltaKind:
+		if dataType == "string" {
+			return fmt.Errorf("kind %s cannot be used with type %s, only with numeric types", kind, dataType)
+		}
+		return nil
+	}
+	return fmt.Errorf("unsupported kind %s, expected %s, %s, %s or %s", kind, gaugeKind, counterKind, deriveKind, deltaKind)
+}
+
+// rateKey identifies samples of metric collected by task, tasks with different config keep separate samples
+// of the same namespace
+func rateKey(ns plugin.Namespace, cfg plugin.Config) string {
+	return ns.String() + "|" + configIdentity(cfg)
+}
+
+// configIdentity returns items of config in order of their keys
+func configIdentity(cfg plugin.Config) string {
+	keys := make([]string, 0, len(cfg))
+	for k := range cfg {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	items := make([]string, len(keys))
+	for i, k := range keys {
+		items[i] = fmt.Sprintf("%q=%#v", k, cfg[k])
+	}
+	return strings.Join(items, ",")
+}
+
+// rateSample previous sample of counter, derive or delta metric
+type rateSample struct {
+	value    float64
+	time     time.Time
+	interval time.Duration //time between the last two samples
+}
+
+// rateCache stores previous samples of counter, derive and delta metrics identified by rateKey,
+// samples which were not updated for several intervals of their metrics are removed
+type rateCache struct {
+	mu        sync.Mutex
+	samples   map[string]rateSample
+	lastSweep time.Time
+}
+
+func newRateCache() *rateCache {
+	return &rateCache{samples: map[string]rateSample{}}
+}
+
+// rate returns per-second rate of change of value since previous sample of metric, or the change itself
+// for delta metrics, false is returned when there is no previous sample, the first sample is only stored
+func (c *rateCache) rate(key string, kind string, dataType string, value float64, t time.Time) (float64, bool) {
+	c.mu.Lock()
+	prev, ok := c.samples[key]
+	sample := rateSample{value: value, time: t}
+	if ok {
+		sample.interval = t.Sub(prev.time)
+	}
+	c.samples[key] = sample
+	c.sweep(t)
+	c.mu.Unlock()
+
+	elapsed := t.Sub(prev.time).Seconds()
+	if !ok || elapsed <= 0 {
+		return 0, false
+	}
+	delta := value - prev.value
+	if kind == counterKind && delta < 0 {
+		delta = counterIncrease(prev.value, value, dataType)
+	}
+	if kind == deltaKind {
+		return delta, true
+	}
+	return delta / elapsed, true
+}
+
+// sweep removes samples which were not updated for staleSampleIntervals intervals of their metrics,
+// it must be called with mutex locked
+func (c *rateCache) sweep(now time.Time) {
+	if now.Sub(c.lastSweep) < sampleSweepInterval {
+		return
+	}
+	c.lastSweep = now
+	for key, sample := range c.samples {
+		timeout := staleSampleTimeout
+		if sample.interval > 0 {
+			timeout = staleSampleIntervals * sample.interval
+		}
+		if now.Sub(sample.time) > timeout {
+			delete(c.samples, key)
+		}
+	}
+}
+
+// counterIncrease returns increase of counter which decreased between samples, it is treated as wrap around
+// when previous value was in upper half of range of data type and current value is in lower half,
+// otherwise counter was reset and current value is its increase since then
+func counterIncrease(prev float64, value float64, dataType string) float64 {
+	if max, ok := counterMax[dataType]; ok && prev > max/2 && value >= 0 && value <= max/2 {
+		return max - prev + value + 1
+	}
+	return value
+}
@@ -0,0 +1,238 @@
+// +build linux
+
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+
+Copyright 2016 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package collector
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/intelsdi-x/snap-plugin-lib-go/v1/plugin"
+	"github.com/intelsdi-x/snap/core/serror"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestValidateKind(t *testing.T) {
+	Convey("Validating kind of metric", t, func() {
+		So(validateKind("", "string"), ShouldBeNil)
+		So(validateKind(gaugeKind, "string"), ShouldBeNil)
+		So(validateKind(counterKind, "uint64"), ShouldBeNil)
+		So(validateKind(deriveKind, "float64"), ShouldBeNil)
+		So(validateKind(deltaKind, "int64"), ShouldBeNil)
+
+		err := validateKind(counterKind, "string")
+		So(err, ShouldNotBeNil)
+		So(err.Error(), ShouldEqual, "kind counter cannot be used with type string, only with numeric types")
+
+		err = validateKind("rate", "int64")
+		So(err, ShouldNotBeNil)
+		So(err.Error(), ShouldEqual, "unsupported kind rate, expected gauge, counter, derive or delta")
+	})
+}
+
+func TestRateCache(t *testing.T) {
+	Convey("Computing rates of counter and derive metrics", t, func() {
+		c := newRateCache()
+		start := time.Now()
+		at := func(seconds int) time.Time {
+			return start.Add(time.Duration(seconds) * time.Second)
+		}
+
+		Convey("first sample is dropped", func() {
+			_, ok := c.rate("/intel/exec/a", counterKind, "uint64", 100, at(0))
+			So(ok, ShouldBeFalse)
+		})
+
+		Convey("rate is increase per second", func() {
+			c.rate("/intel/exec/a", counterKind, "uint64", 100, at(0))
+			rate, ok := c.rate("/intel/exec/a", counterKind, "uint64", 150, at(10))
+			So(ok, ShouldBeTrue)
+			So(rate, ShouldEqual, 5)
+			rate, ok = c.rate("/intel/exec/a", counterKind, "uint64", 150, at(20))
+			So(ok, ShouldBeTrue)
+			So(rate, ShouldEqual, 0)
+		})
+
+		Convey("samples of metrics are kept separately", func() {
+			c.rate("/intel/exec/a", counterKind, "uint64", 100, at(0))
+			_, ok := c.rate("/intel/exec/b", counterKind, "uint64", 200, at(10))
+			So(ok, ShouldBeFalse)
+		})
+
+		Convey("reset counter increased by its current value", func() {
+			c.rate("/intel/exec/a", counterKind, "uint64", 1000, at(0))
+			rate, ok := c.rate("/intel/exec/a", counterKind, "uint64", 20, at(10))
+			So(ok, ShouldBeTrue)
+			So(rate, ShouldEqual, 2)
+		})
+
+		Convey("counter wraps around at max value of its type", func() {
+			c.rate("/intel/exec/a", counterKind, "uint32", 4294967290, at(0))
+			rate, ok := c.rate("/intel/exec/a", counterKind, "uint32", 4, at(10))
+			So(ok, ShouldBeTrue)
+			So(rate, ShouldEqual, 1)
+
+			c.rate("/intel/exec/b", counterKind, "uint8", 250, at(0))
+			rate, ok = c.rate("/intel/exec/b", counterKind, "uint8", 14, at(2))
+			So(ok, ShouldBeTrue)
+			So(rate, ShouldEqual, 10)
+		})
+
+		Convey("counters of float types are only reset", func() {
+			c.rate("/intel/exec/a", counterKind, "float64", 1e300, at(0))
+			rate, ok := c.rate("/intel/exec/a", counterKind, "float64", 10, at(10))
+			So(ok, ShouldBeTrue)
+			So(rate, ShouldEqual, 1)
+		})
+
+		Convey("derive can decrease", func() {
+			c.rate("/intel/exec/a", deriveKind, "int64", 100, at(0))
+			rate, ok := c.rate("/intel/exec/a", deriveKind, "int64", 50, at(10))
+			So(ok, ShouldBeTrue)
+			So(rate, ShouldEqual, -5)
+		})
+
+		Convey("delta is change since previous sample", func() {
+			c.rate("/intel/exec/a", deltaKind, "int64", 100, at(0))
+			delta, ok := c.rate("/intel/exec/a", deltaKind, "int64", 130, at(10))
+			So(ok, ShouldBeTrue)
+			So(delta, ShouldEqual, 30)
+			delta, ok = c.rate("/intel/exec/a", deltaKind, "int64", 120, at(20))
+			So(ok, ShouldBeTrue)
+			So(delta, ShouldEqual, -10)
+		})
+
+		Convey("samples which were not updated for several intervals are removed", func() {
+			c.rate("/intel/exec/a", counterKind, "uint64", 100, at(0))
+			c.rate("/intel/exec/a", counterKind, "uint64", 200, at(60))
+			c.rate("/intel/exec/b", counterKind, "uint64", 100, at(0))
+			c.rate("/intel/exec/c", counterKind, "uint64", 100, at(0))
+			c.rate("/intel/exec/c", counterKind, "uint64", 200, at(200))
+			So(c.samples, ShouldContainKey, "/intel/exec/a")
+
+			c.rate("/intel/exec/c", counterKind, "uint64", 300, at(400))
+			So(c.samples, ShouldNotContainKey, "/intel/exec/a")
+			So(c.samples, ShouldContainKey, "/intel/exec/b")
+			So(c.samples, ShouldContainKey, "/intel/exec/c")
+
+			c.rate("/intel/exec/c", counterKind, "uint64", 400, at(int(staleSampleTimeout/time.Second)+60))
+			So(c.samples, ShouldNotContainKey, "/intel/exec/b")
+		})
+
+				Convey("samples without elapsed time are treated as first samples", func() {
+			c.rate("/intel/exec/a", counterKind, "uint64", 100, at(10))
+			_, ok := c.rate("/intel/exec/a", counterKind, "uint64", 200, at(10))
+			So(ok, ShouldBeFalse)
+			_, ok = c.rate("/intel/exec/a", counterKind, "uint64", 300, at(5))
+			So(ok, ShouldBeFalse)
+			rate, ok := c.rate("/intel/exec/a", counterKind, "uint64", 400, at(15))
+			So(ok, ShouldBeTrue)
+			So(rate, ShouldEqual, 10)
+		})
+	})
+}
+
+func TestCollectCounters(t *testing.T) {
+	Convey("Collecting counter metrics", t, func() {
+		createMockFile([]byte(`{
+			"packets": {"exec": "/bin/cat", "type": "uint64", "kind": "counter"},
+			"packets_total": {"exec": "/bin/cat", "type": "uint64"}
+		}`))
+		defer deleteMockFile()
+
+		config := plugin.Config{}
+		config[setFileConfigVar] = mockFilePath
+		config[execTimeOutConfigVar] = int64(10)
+
+		plg := New()
+		total := 1000
+		plg.cmd = func(cmd command) ([]byte, serror.SnapError) {
+			total += 500
+			return []byte(fmt.Sprint(total)), nil
+		}
+		_, err := plg.GetMetricTypes(config)
+		So(err, ShouldBeNil)
+
+		mts := []plugin.Metric{
+			{Namespace: plugin.NewNamespace(vendor, pluginName, "packets"), Config: config},
+		}
+
+		Convey("first sample is dropped and rate is collected afterwards", func() {
+			results, err := plg.CollectMetrics(mts)
+			So(err, ShouldBeNil)
+			So(results, ShouldBeEmpty)
+
+			time.Sleep(10 * time.Millisecond)
+			results, err = plg.CollectMetrics(mts)
+			So(err, ShouldBeNil)
+			So(len(results), ShouldEqual, 1)
+			rate, ok := results[0].Data.(float64)
+			So(ok, ShouldBeTrue)
+			So(rate, ShouldBeGreaterThan, 0)
+			So(rate, ShouldBeLessThan, 500/0.01)
+		})
+
+		Convey("first sample is not exposed", func() {
+			mts[0].Config = config
+			results, serr := plg.collect(mts)
+			So(serr, ShouldBeNil)
+			So(results[0].err, ShouldBeNil)
+			So(results[0].metrics, ShouldBeEmpty)
+			body := string(renderExposition(mts, results, plg.currentSetFile().metrics))
+			So(body, ShouldNotContainSubstring, "intel_exec_packets ")
+			So(body, ShouldContainSubstring, `exec_metric_success{namespace="/intel/exec/packets"} 1`)
+		})
+
+		Convey("samples of tasks with different config are kept separately", func() {
+			other := plugin.Config{}
+			for k, v := range config {
+				other[k] = v
+			}
+			other["device"] = "eth1"
+
+			_, err := plg.CollectMetrics(mts)
+			So(err, ShouldBeNil)
+			results, err := plg.CollectMetrics([]plugin.Metric{{Namespace: mts[0].Namespace, Config: other}})
+			So(err, ShouldBeNil)
+			So(results, ShouldBeEmpty)
+
+			time.Sleep(10 * time.Millisecond)
+			results, err = plg.CollectMetrics(mts)
+			So(err, ShouldBeNil)
+			So(len(results), ShouldEqual, 1)
+		})
+
+				Convey("gauges are collected as they are", func() {
+			results, err := plg.CollectMetrics([]plugin.Metric{{Namespace: plugin.NewNamespace(vendor, pluginName, "packets_total"), Config: config}})
+			So(err, ShouldBeNil)
+			So(len(results), ShouldEqual, 1)
+			So(results[0].Data, ShouldEqual, uint64(1500))
+		})
+
+		Convey("kind is checked when setfile is loaded", func() {
+			createMockFile([]byte(`{"packets": {"exec": "/bin/cat", "type": "string", "kind": "counter"}}`))
+			_, err := New().GetMetricTypes(config)
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "kind counter cannot be used with type string, only with numeric types for packets")
+		})
+	})
+}
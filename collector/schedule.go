@@ -0,0 +1,346 @@
+// +build linux
+
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+
+Copyright 2016 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package collector
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/intelsdi-x/snap-plugin-lib-go/v1/plugin"
+)
+
+const (
+	//jsonLinesFormat results written as JSON object per line
+	jsonLinesFormat = "json"
+
+	//csvFormat results written as CSV records
+	csvFormat = "csv"
+
+	//influxFormat results written in InfluxDB line protocol
+	influxFormat = "influx"
+
+	//maxSchedulerSleep max time for which scheduler sleeps, so metrics added to setfile are scheduled without delay
+	maxSchedulerSleep = time.Second
+
+	//defaultOutputMaxSize default max size of output file of scheduler in megabytes
+	defaultOutputMaxSize = 100
+
+	//defaultOutputMaxBackups default number of rotated output files of scheduler
+	defaultOutputMaxBackups = 5
+)
+
+// sampleRecord result of collection of metric written by scheduler
+type sampleRecord struct {
+	Timestamp   string            `json:"timestamp"`
+	Namespace   string            `json:"namespace"`
+	Type        string            `json:"type"`
+	Value       interface{}       `json:"value,omitempty"`
+	Unit        string            `json:"unit,omitempty"`
+	Tags        map[string]string `json:"tags,omitempty"`
+	DurationSec float64           `json:"duration_sec"`
+	Error       string            `json:"error,omitempty"`
+
+	time time.Time
+	ns   []string
+}
+
+// scheduler collects metrics defined in setfile on their intervals without snap daemon
+type scheduler struct {
+	plugin   *Plugin
+	config   plugin.Config
+	interval time.Duration
+	jitter   time.Duration
+	format   string
+	out      io.Writer
+	rand     *rand.Rand
+
+	mu      sync.Mutex
+	running map[string]bool
+	next    map[string]time.Time
+	wg      sync.WaitGroup
+}
+
+// newScheduler returns scheduler which writes results in given format, interval is used for metrics
+// without interval defined in setfile, the first execution of each metric is delayed by random time up to jitter
+// and commands running longer than timeout are killed
+func newScheduler(p *Plugin, cfg plugin.Config, interval time.Duration, jitter time.Duration, timeout time.Duration, format string, out io.Writer) *scheduler {
+	if timeout > 0 {
+		p.cmd = executeCmdWithTimeout(timeout)
+	}
+	return &scheduler{
+		plugin:   p,
+		config:   cfg,
+		interval: interval,
+		jitter:   jitter,
+		format:   format,
+		out:      out,
+		rand:     rand.New(rand.NewSource(time.Now().UnixNano())),
+		running:  map[string]bool{},
+		next:     map[string]time.Time{},
+	}
+}
+
+// validateSampleFormat checks if format of results written by scheduler is supported
+func validateSampleFormat(format string) error {
+	switch format {
+	case jsonLinesFormat, csvFormat, influxFormat:
+		return nil
+	}
+	return fmt.Errorf("unsupported format %s, expected %s, %s or %s", format, jsonLinesFormat, csvFormat, influxFormat)
+}
+
+// run executes metrics until stop is closed, metrics still running are waited for
+func (s *scheduler) run(stop <-chan struct{}) {
+	defer s.wg.Wait()
+	for {
+		wake := s.schedule(time.Now())
+		select {
+		case <-stop:
+			return
+		case <-time.After(wake.Sub(time.Now())):
+		}
+	}
+}
+
+// schedule starts metrics which are due and returns time when scheduler should check them again,
+// metrics are read from setfile each time, so modifications of setfile are applied
+func (s *scheduler) schedule(now time.Time) time.Time {
+	wake := now.Add(maxSchedulerSleep)
+
+	mts, err := s.plugin.GetMetricTypes(s.config)
+	if err != nil {
+		log.Error(err.Error())
+		return wake
+	}
+	metrics := s.plugin.currentSetFile().metrics
+	prefix, _ := getNamespacePrefix(s.config)
+	catalog, _ := s.plugin.currentSetFile().catalog(prefix)
+
+	//metrics defined by the same entry of setfile, e.g. columns of table, are collected together
+	names := []string{}
+	entries := map[string][]plugin.Metric{}
+	for _, mt := range mts {
+		name := catalog[namespaceKey(mt.Namespace)].name
+		if _, ok := entries[name]; !ok {
+			names = append(names, name)
+		}
+		entries[name] = append(entries[name], mt)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, name := range names {
+		next, ok := s.next[name]
+		if !ok {
+			next = now.Add(s.randomDelay())
+		}
+		if !now.Before(next) {
+			next = nextDue(next, now, metrics[name].interval(s.interval))
+			if !s.running[name] {
+				s.running[name] = true
+				s.wg.Add(1)
+				go s.collect(name, entries[name])
+			}
+		}
+		s.next[name] = next
+		if next.Before(wake) {
+			wake = next
+		}
+	}
+
+	//metrics removed from setfile
+	for name := range s.next {
+		if _, ok := entries[name]; !ok {
+			delete(s.next, name)
+		}
+	}
+	return wake
+}
+
+// nextDue returns the first time after now on the grid of interval starting at due, so the random delay
+// of the first execution is kept and the period does not drift; executions missed e.g. during suspend are skipped
+func nextDue(due, now time.Time, interval time.Duration) time.Time {
+	missed := now.Sub(due) / interval
+	return due.Add((missed + 1) * interval)
+}
+
+func (s *scheduler) randomDelay() time.Duration {
+	if s.jitter <= 0 {
+		return 0
+	}
+	return time.Duration(s.rand.Int63n(int64(s.jitter)))
+}
+
+// collect executes metrics defined by single entry of setfile and writes their results
+func (s *scheduler) collect(name string, mts []plugin.Metric) {
+	defer s.wg.Done()
+	defer func() {
+		s.mu.Lock()
+		s.running[name] = false
+		s.mu.Unlock()
+	}()
+
+	for i := range mts {
+		mts[i].Config = s.config
+	}
+	results, serr := s.plugin.collect(mts)
+	if serr != nil {
+		log.WithFields(serr.Fields()).Error(serr.Error())
+		return
+	}
+
+	records := []sampleRecord{}
+	for i, r := range results {
+		record := sampleRecord{
+			Namespace:   mts[i].Namespace.String(),
+			Type:        s.plugin.currentSetFile().metrics[r.name].valueType(r.column),
+			DurationSec: r.duration.Seconds(),
+			time:        time.Now(),
+			ns:          mts[i].Namespace.Strings(),
+		}
+		if r.err != nil {
+			log.WithFields(r.err.Fields()).Warn(r.err.Error())
+			record.Error = r.err.Error()
+			records = append(records, record)
+		}
+		for _, m := range r.metrics {
+			value := record
+			value.Namespace = m.Namespace.String()
+			value.ns = m.Namespace.Strings()
+			value.Value = m.Data
+			value.Unit = m.Unit
+			value.Tags = m.Tags
+			value.time = m.Timestamp
+			records = append(records, value)
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, record := range records {
+		record.Timestamp = record.time.UTC().Format(time.RFC3339Nano)
+		line, err := formatSample(s.format, record)
+		if err != nil {
+			log.WithFields(map[string]interface{}{"namespace": record.Namespace}).Errorf("Cannot format result: %v", err)
+			continue
+		}
+		if line == nil {
+			continue
+		}
+		if _, err := s.out.Write(line); err != nil {
+			log.Errorf("Cannot write result: %v", err)
+		}
+	}
+}
+
+// formatSample formats result as single line, failed metrics are not written in InfluxDB line protocol
+func formatSample(format string, r sampleRecord) ([]byte, error) {
+	switch format {
+	case csvFormat:
+		value := ""
+		if r.Value != nil {
+			value = fmt.Sprint(r.Value)
+		}
+		var buf bytes.Buffer
+		w := csv.NewWriter(&buf)
+		w.Write([]string{r.Timestamp, r.Namespace, r.Type, value, r.Unit, formatTags(r.Tags),
+			strconv.FormatFloat(r.DurationSec, 'f', -1, 64), r.Error})
+		w.Flush()
+		return buf.Bytes(), w.Error()
+	case influxFormat:
+		if r.Error != "" {
+			return nil, nil
+		}
+		field, err := influxFieldValue(r.Value)
+		if err != nil {
+			return nil, err
+		}
+		line := escapeInflux(strings.Join(r.ns, "/"), ", ")
+		names := sortedTags(r.Tags)
+		for _, name := range names {
+			line += "," + escapeInflux(name, ",= ") + "=" + escapeInflux(r.Tags[name], ",= ")
+		}
+		return []byte(fmt.Sprintf("%s value=%s %d\n", line, field, r.time.UnixNano())), nil
+	default:
+		line, err := json.Marshal(r)
+		if err != nil {
+			return nil, err
+		}
+		return append(line, '\n'), nil
+	}
+}
+
+// influxFieldValue formats value of metric as field of InfluxDB line protocol
+func influxFieldValue(value interface{}) (string, error) {
+	switch v := value.(type) {
+	case float64:
+		return strconv.FormatFloat(v, 'g', -1, 64), nil
+	case float32:
+		return strconv.FormatFloat(float64(v), 'g', -1, 32), nil
+	case int64, int32, int16, int8:
+		return fmt.Sprintf("%di", v), nil
+	case uint64, uint32, uint16, uint8:
+		return fmt.Sprintf("%du", v), nil
+	case string:
+		return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(v) + `"`, nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	}
+	return "", fmt.Errorf("unsupported value %v of type %T", value, value)
+}
+
+// escapeInflux escapes characters of measurement, tag key or tag value in InfluxDB line protocol
+func escapeInflux(s string, chars string) string {
+	for _, c := range chars {
+		s = strings.Replace(s, string(c), `\`+string(c), -1)
+	}
+	return s
+}
+
+func sortedTags(tags map[string]string) []string {
+	names := make([]string, 0, len(tags))
+	for name := range tags {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// formatTags formats tags sorted by their names, e.g. a=1;b=2
+func formatTags(tags map[string]string) string {
+	pairs := []string{}
+	for _, name := range sortedTags(tags) {
+		pairs = append(pairs, name+"="+tags[name])
+	}
+	return strings.Join(pairs, ";")
+}
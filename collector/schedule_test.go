@@ -0,0 +1,209 @@
+// +build linux
+
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+
+Copyright 2016 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package collector
+
+import (
+	"bytes"
+	"io/ioutil"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/intelsdi-x/snap-plugin-lib-go/v1/plugin"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestScheduler(t *testing.T) {
+	Convey("Standalone scheduler", t, func() {
+		createMockFile(mockFileContSchedule)
+		defer deleteMockFile()
+
+		config := plugin.Config{}
+		config[setFileConfigVar] = mockFilePath
+		config[execTimeOutConfigVar] = int64(10)
+
+		p := New()
+		p.cmd = mockExecuteCmd
+		out := &bytes.Buffer{}
+		s := newScheduler(p, config, 50*time.Millisecond, 10*time.Millisecond, 0, jsonLinesFormat, out)
+
+		stop := make(chan struct{})
+		go func() {
+			time.Sleep(300 * time.Millisecond)
+			close(stop)
+		}()
+		s.run(stop)
+
+		Convey("metrics are collected on their intervals", func() {
+			fast := strings.Count(out.String(), `"namespace":"/intel/exec/fast"`)
+			slow := strings.Count(out.String(), `"namespace":"/intel/exec/slow"`)
+			So(fast, ShouldBeGreaterThanOrEqualTo, 3)
+			So(slow, ShouldEqual, 1)
+			So(out.String(), ShouldContainSubstring, `"value":65`)
+		})
+	})
+
+	Convey("Standalone scheduler kills commands running longer than timeout", t, func() {
+		createMockFile(mockFileContScheduleSlow)
+		defer deleteMockFile()
+
+		config := plugin.Config{}
+		config[setFileConfigVar] = mockFilePath
+		config[execTimeOutConfigVar] = int64(10)
+
+		p := New()
+		out := &bytes.Buffer{}
+		s := newScheduler(p, config, time.Hour, 0, 100*time.Millisecond, jsonLinesFormat, out)
+
+		start := time.Now()
+		stop := make(chan struct{})
+		go func() {
+			time.Sleep(500 * time.Millisecond)
+			close(stop)
+		}()
+		s.run(stop)
+
+		So(time.Since(start), ShouldBeLessThan, 2*time.Second)
+		So(out.String(), ShouldContainSubstring, `"namespace":"/intel/exec/hang"`)
+		So(out.String(), ShouldContainSubstring, "did not finish in time")
+	})
+}
+
+func TestSchedulePeriod(t *testing.T) {
+	Convey("Standalone scheduler keeps interval of metrics", t, func() {
+		createMockFile(mockFileContSchedule)
+		defer deleteMockFile()
+
+		config := plugin.Config{}
+		config[setFileConfigVar] = mockFilePath
+		config[execTimeOutConfigVar] = int64(10)
+
+		p := New()
+		p.cmd = mockExecuteCmd
+		interval := 50 * time.Millisecond
+		s := newScheduler(p, config, interval, 20*time.Millisecond, 0, jsonLinesFormat, ioutil.Discard)
+
+		//time is advanced to times returned by scheduler, so executions are due exactly on them
+		due := []time.Time{}
+		now := time.Now()
+		for len(due) < 100 {
+			next, ok := s.next["fast"]
+			if ok && !now.Before(next) {
+				due = append(due, now)
+			}
+			now = s.schedule(now)
+		}
+		s.wg.Wait()
+
+		So(due[len(due)-1].Sub(due[0])/time.Duration(len(due)-1), ShouldEqual, interval)
+		So(due[1].Sub(due[0]), ShouldEqual, interval)
+
+		Convey("and skips missed executions", func() {
+			last := s.next["fast"]
+			next := nextDue(last, last.Add(5*interval+time.Millisecond), interval)
+			So(next, ShouldResemble, last.Add(6*interval))
+		})
+	})
+}
+
+func TestFormatSample(t *testing.T) {
+	Convey("Formatting results of scheduler", t, func() {
+		ts := time.Unix(1500000000, 0)
+		r := sampleRecord{
+			Timestamp:   ts.UTC().Format(time.RFC3339Nano),
+			Namespace:   "/intel/exec/db/size",
+			Type:        "int64",
+			Value:       int64(42),
+			Unit:        "B",
+			Tags:        map[string]string{"team": "db", "host name": "a,b"},
+			DurationSec: 0.5,
+			time:        ts,
+			ns:          []string{"intel", "exec", "db", "size"},
+		}
+
+		Convey("as JSON lines", func() {
+			line, err := formatSample(jsonLinesFormat, r)
+			So(err, ShouldBeNil)
+			So(string(line), ShouldEqual, `{"timestamp":"2017-07-14T02:40:00Z","namespace":"/intel/exec/db/size","type":"int64","value":42,"unit":"B",`+
+				`"tags":{"host name":"a,b","team":"db"},"duration_sec":0.5}`+"\n")
+		})
+
+		Convey("as CSV", func() {
+			line, err := formatSample(csvFormat, r)
+			So(err, ShouldBeNil)
+			So(string(line), ShouldEqual, "2017-07-14T02:40:00Z,/intel/exec/db/size,int64,42,B,\"host name=a,b;team=db\",0.5,\n")
+		})
+
+		Convey("in InfluxDB line protocol", func() {
+			line, err := formatSample(influxFormat, r)
+			So(err, ShouldBeNil)
+			So(string(line), ShouldEqual, `intel/exec/db/size,host\ name=a\,b,team=db value=42i 1500000000000000000`+"\n")
+
+			r.Value = "up \"now\""
+			line, err = formatSample(influxFormat, r)
+			So(err, ShouldBeNil)
+			So(string(line), ShouldContainSubstring, `value="up \"now\""`)
+		})
+
+		Convey("failed metrics are not written in InfluxDB line protocol", func() {
+			r.Error = "exit status 1"
+			line, err := formatSample(influxFormat, r)
+			So(err, ShouldBeNil)
+			So(line, ShouldBeNil)
+		})
+	})
+}
+
+func TestMetricInterval(t *testing.T) {
+	Convey("Interval of metric", t, func() {
+		So(metric{Interval: "30s"}.interval(time.Minute), ShouldEqual, 30*time.Second)
+		So(metric{}.interval(time.Minute), ShouldEqual, time.Minute)
+
+		Convey("must be a positive duration", func() {
+			createMockFile([]byte(`{"m": {"exec": "/bin/echo", "type": "int64", "interval": "-5s"}}`))
+			defer deleteMockFile()
+			_, err := New().GetMetricTypes(plugin.Config{setFileConfigVar: mockFilePath})
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "interval must be a positive duration")
+		})
+	})
+}
+
+var mockFileContSchedule = []byte(`{
+	"fast": {
+		"exec": "/bin/echo",
+		"type": "int64"
+	},
+	"slow": {
+		"exec": "/bin/echo",
+		"type": "int64",
+		"interval": "1h"
+	}
+}`)
+
+var mockFileContScheduleSlow = []byte(`{
+	"hang": {
+		"exec": "/bin/sleep",
+		"args": ["5"],
+		"type": "int64"
+	}
+}`)
@@ -0,0 +1,275 @@
+// +build linux
+
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+
+Copyright 2016 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package collector
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// schemaError describes incorrect element of metric definition
+type schemaError struct {
+	path    []string
+	message string
+}
+
+func (e *schemaError) Error() string {
+	return e.message
+}
+
+// validateMetricDefinition checks that metric definition decoded from setfile matches metric structure,
+// unknown fields and values of incorrect types are rejected, the error names the metric, field and its position
+func validateMetricDefinition(name string, definition interface{}, positions map[string]position) error {
+	err := checkValue(definition, reflect.TypeOf(metric{}), []string{name})
+	if err == nil {
+		return nil
+	}
+	serr := err.(*schemaError)
+	field := strings.Join(serr.path[1:], ".")
+	if field == "" {
+		return fmt.Errorf("%s for %s at %s", serr.message, name, positionOf(positions, serr.path))
+	}
+	return fmt.Errorf("%s in field %s of %s at %s", serr.message, field, name, positionOf(positions, serr.path))
+}
+
+// positionOf returns position of element, if it is not known position of the closest parent is returned
+func positionOf(positions map[string]position, path []string) position {
+	for i := len(path); i > 0; i-- {
+		if pos, ok := positions[keyPath(path[:i]...)]; ok {
+			return pos
+		}
+	}
+	return position{}
+}
+
+// checkValue checks if value decoded from setfile can be decoded to type t without losing any information
+func checkValue(value interface{}, t reflect.Type, path []string) error {
+	switch t.Kind() {
+	case reflect.Interface:
+		return nil
+	case reflect.String:
+		if _, ok := value.(string); !ok {
+			return &schemaError{path: path, message: fmt.Sprintf("expected string, got %s", describeValue(value))}
+		}
+	case reflect.Bool:
+		if _, ok := value.(bool); !ok {
+			return &schemaError{path: path, message: fmt.Sprintf("expected boolean, got %s", describeValue(value))}
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if f, ok := toFloat(value); !ok || f != math.Trunc(f) {
+			return &schemaError{path: path, message: fmt.Sprintf("expected integer, got %s", describeValue(value))}
+		}
+	case reflect.Float32, reflect.Float64:
+		if _, ok := toFloat(value); !ok {
+			return &schemaError{path: path, message: fmt.Sprintf("expected number, got %s", describeValue(value))}
+		}
+	case reflect.Slice:
+		items, ok := value.([]interface{})
+		if !ok {
+			return &schemaError{path: path, message: fmt.Sprintf("expected list, got %s", describeValue(value))}
+		}
+		for i, item := range items {
+			if err := checkValue(item, t.Elem(), appendPath(path, fmt.Sprint(i))); err != nil {
+				return err
+			}
+		}
+	case reflect.Map:
+		items, ok := value.(map[string]interface{})
+		if !ok {
+			return &schemaError{path: path, message: fmt.Sprintf("expected object, got %s", describeValue(value))}
+		}
+		for k, item := range items {
+			if err := checkValue(item, t.Elem(), appendPath(path, k)); err != nil {
+				return err
+			}
+		}
+	case reflect.Struct:
+		items, ok := value.(map[string]interface{})
+		if !ok {
+			return &schemaError{path: path, message: fmt.Sprintf("expected object, got %s", describeValue(value))}
+		}
+		fields := structFields(t)
+		keys := make([]string, 0, len(items))
+		for k := range items {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			field, ok := fields[k]
+			if !ok {
+				message := fmt.Sprintf("unknown field %s", k)
+				if suggestion := closestField(k, fields); suggestion != "" {
+					message += fmt.Sprintf(" (did you mean %s?)", suggestion)
+				}
+				return &schemaError{path: appendPath(path, k), message: message}
+			}
+			if err := checkValue(items[k], field.Type, appendPath(path, k)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// structFields returns fields of struct by their names in setfile, which are defined by mapstructure tag
+// or are equal to lower-cased names of fields
+func structFields(t reflect.Type) map[string]reflect.StructField {
+	fields := map[string]reflect.StructField{}
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.PkgPath != "" {
+			continue
+		}
+		name := strings.Split(field.Tag.Get("mapstructure"), ",")[0]
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = strings.ToLower(field.Name)
+		}
+		fields[name] = field
+	}
+	return fields
+}
+
+// definitionOf returns metric definition as it could be written in setfile, fields with zero values are omitted
+func definitionOf(m metric) map[string]interface{} {
+	definition := map[string]interface{}{}
+	value := reflect.ValueOf(m)
+	for name, field := range structFields(value.Type()) {
+		fieldValue := value.FieldByIndex(field.Index).Interface()
+		if !reflect.DeepEqual(fieldValue, reflect.Zero(field.Type).Interface()) {
+			definition[name] = fieldValue
+		}
+	}
+	return definition
+}
+
+// closestField returns name of field which differs from key by at most two characters
+func closestField(key string, fields map[string]reflect.StructField) string {
+	closest := ""
+	minDistance := 3
+	for name := range fields {
+		if d := editDistance(key, name); d < minDistance || (d == minDistance && name < closest) {
+			closest = name
+			minDistance = d
+		}
+	}
+	if minDistance > 2 {
+		return ""
+	}
+	return closest
+}
+
+// editDistance returns Levenshtein distance between a and b
+func editDistance(a string, b string) int {
+	prev := make([]int, len(b)+1)
+	curr := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		curr[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			curr[j] = minInt(minInt(prev[j]+1, curr[j-1]+1), prev[j-1]+cost)
+		}
+		prev, curr = curr, prev
+	}
+	return prev[len(b)]
+}
+
+func minInt(a int, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+// toFloat converts numbers decoded from JSON, YAML or TOML to float64
+func toFloat(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case float64:
+		return v, true
+	case int:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case uint64:
+		return float64(v), true
+	}
+	return 0, false
+}
+
+// describeValue returns name of type of value decoded from setfile
+func describeValue(value interface{}) string {
+	switch value.(type) {
+	case nil:
+		return "null"
+	case string:
+		return "string"
+	case bool:
+		return "boolean"
+	case []interface{}:
+		return "list"
+	case map[string]interface{}:
+		return "object"
+	}
+	if _, ok := toFloat(value); ok {
+		return "number"
+	}
+	return fmt.Sprintf("%T", value)
+}
+
+func appendPath(path []string, elem string) []string {
+	return append(append([]string{}, path...), elem)
+}
+
+// offsetPosition converts byte offset in content to position
+func offsetPosition(file string, content []byte, offset int64) position {
+	if offset > int64(len(content)) {
+		offset = int64(len(content))
+	}
+	before := content[:offset]
+	line := bytes.Count(before, []byte("\n")) + 1
+	column := len(before) - bytes.LastIndexByte(before, '\n')
+	return position{file: file, line: line, column: column}
+}
+
+// jsonErrorPosition returns position of JSON decoding error
+func jsonErrorPosition(file string, content []byte, err error) (position, bool) {
+	switch e := err.(type) {
+	case *json.SyntaxError:
+		return offsetPosition(file, content, e.Offset), true
+	case *json.UnmarshalTypeError:
+		return offsetPosition(file, content, e.Offset), true
+	}
+	return position{}, false
+}
@@ -0,0 +1,193 @@
+// +build linux
+
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+
+Copyright 2016 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package collector
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestValidateMetricDefinition(t *testing.T) {
+	Convey("Validating metric definition", t, func() {
+		decoded, positions, err := decodeSetFile("setfile.json", mockFileContSchema, "")
+		So(err, ShouldBeNil)
+
+		Convey("correct definition is accepted", func() {
+			So(validateMetricDefinition("metric0", decoded["metric0"], positions), ShouldBeNil)
+		})
+
+		Convey("unknown field is rejected with suggestion of known field", func() {
+			err := validateMetricDefinition("metric1", decoded["metric1"], positions)
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldEqual, "unknown field tpye (did you mean type?) in field tpye of metric1 at setfile.json:8:5")
+		})
+
+		Convey("value of incorrect type is rejected", func() {
+			err := validateMetricDefinition("metric2", decoded["metric2"], positions)
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldEqual, "expected string, got number in field args.1 of metric2 at setfile.json:13:20")
+		})
+
+		Convey("non-integer index is rejected", func() {
+			err := validateMetricDefinition("metric3", decoded["metric3"], positions)
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "expected integer, got number in field redact_args.0 of metric3")
+		})
+
+		Convey("definition which is not an object is rejected", func() {
+			err := validateMetricDefinition("metric4", decoded["metric4"], positions)
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldEqual, "expected object, got string for metric4 at setfile.json:21:3")
+		})
+	})
+}
+
+func TestEditDistance(t *testing.T) {
+	Convey("Computing edit distance", t, func() {
+		So(editDistance("type", "type"), ShouldEqual, 0)
+		So(editDistance("tpye", "type"), ShouldEqual, 2)
+		So(editDistance("arg", "args"), ShouldEqual, 1)
+		So(editDistance("", "env"), ShouldEqual, 3)
+	})
+}
+
+func TestOffsetPosition(t *testing.T) {
+	Convey("Converting offset to position", t, func() {
+		content := []byte("{\n  \"a\": 1,\n}")
+		So(offsetPosition("f", content, 0), ShouldResemble, position{file: "f", line: 1, column: 1})
+		So(offsetPosition("f", content, 4), ShouldResemble, position{file: "f", line: 2, column: 3})
+		So(offsetPosition("f", content, 100), ShouldResemble, position{file: "f", line: 3, column: 2})
+
+		var decoded interface{}
+		err := json.Unmarshal(content, &decoded)
+		pos, ok := jsonErrorPosition("f", content, err)
+		So(ok, ShouldBeTrue)
+		So(pos.line, ShouldEqual, 3)
+	})
+}
+
+func TestGetMetricsFromConfigSchema(t *testing.T) {
+	Convey("Loading setfile with strict schema", t, func() {
+		dir, err := ioutil.TempDir("", "exec-schema")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+		path := filepath.Join(dir, "setfile.json")
+
+		Convey("reference to JSON Schema is accepted", func() {
+			So(ioutil.WriteFile(path, []byte(`{"$schema": "setfile.schema.json", "metric0": {"exec": "/bin/ls", "type": "string"}}`), 0644), ShouldBeNil)
+			loaded, serr := getMetricsFromConfig(path, "", false)
+			So(serr, ShouldBeNil)
+			So(loaded.metrics, ShouldContainKey, "metric0")
+			So(loaded.metrics, ShouldNotContainKey, schemaMapKey)
+		})
+
+		Convey("unknown field is reported with its location", func() {
+			So(ioutil.WriteFile(path, []byte("{\n  \"metric0\": {\"exec\": \"/bin/ls\", \"tpye\": \"string\"}\n}"), 0644), ShouldBeNil)
+			_, serr := getMetricsFromConfig(path, "", false)
+			So(serr, ShouldNotBeNil)
+			So(serr.Error(), ShouldContainSubstring, "unknown field tpye (did you mean type?) in field tpye of metric0 at "+path+":2:34")
+		})
+
+		Convey("unsupported type is reported", func() {
+			So(ioutil.WriteFile(path, []byte(`{"metric0": {"exec": "/bin/ls", "type": "int128"}}`), 0644), ShouldBeNil)
+			_, serr := getMetricsFromConfig(path, "", false)
+			So(serr, ShouldNotBeNil)
+			So(serr.Error(), ShouldContainSubstring, "unsupported type int128 of metric0 at "+path+":1:33")
+			So(serr.Error(), ShouldContainSubstring, "expected one of float64")
+		})
+
+		Convey("syntax error is reported with its location", func() {
+			So(ioutil.WriteFile(path, []byte("{\n  \"metric0\": {\"exec\": \"/bin/ls\",}\n}"), 0644), ShouldBeNil)
+			_, serr := getMetricsFromConfig(path, "", false)
+			So(serr, ShouldNotBeNil)
+			So(serr.Error(), ShouldStartWith, "Settings file cannot be unmarshalled")
+			So(serr.Error(), ShouldContainSubstring, path+":2:")
+		})
+
+		Convey("errors in YAML setfile are reported with their location", func() {
+			path := filepath.Join(dir, "setfile.yaml")
+			So(ioutil.WriteFile(path, []byte("metric0:\n  exec: /bin/ls\n  type: string\n  env:\n    LC_ALL: [C]\n"), 0644), ShouldBeNil)
+			_, serr := getMetricsFromConfig(path, "", false)
+			So(serr, ShouldNotBeNil)
+			So(serr.Error(), ShouldContainSubstring, "expected string, got list in field env.LC_ALL of metric0 at "+path+":5:5")
+		})
+	})
+}
+
+func TestPublishedSchema(t *testing.T) {
+	Convey("Published JSON Schema", t, func() {
+		content, err := ioutil.ReadFile("../schema/setfile.schema.json")
+		So(err, ShouldBeNil)
+		var schema struct {
+			Definitions struct {
+				Template struct {
+					Properties map[string]struct {
+						Enum []string `json:"enum"`
+					} `json:"properties"`
+				} `json:"template"`
+			} `json:"definitions"`
+		}
+		So(json.Unmarshal(content, &schema), ShouldBeNil)
+
+		Convey("describes all fields of metric", func() {
+			properties := schema.Definitions.Template.Properties
+			So(len(properties), ShouldEqual, len(structFields(reflect.TypeOf(metric{})))+1)
+			So(properties, ShouldContainKey, extendsMapKey)
+			for name := range structFields(reflect.TypeOf(metric{})) {
+				So(properties, ShouldContainKey, name)
+			}
+		})
+
+		Convey("lists all supported types", func() {
+			So(schema.Definitions.Template.Properties[metricTypeMapKey].Enum, ShouldResemble, supportedTypes)
+		})
+	})
+}
+
+var mockFileContSchema = []byte(`{
+  "metric0": {
+    "exec": "/bin/ls",
+    "type": "string"
+  },
+  "metric1": {
+    "exec": "/bin/ls",
+    "tpye": "string"
+  },
+  "metric2": {
+    "exec": "/bin/ls",
+    "type": "string",
+    "args": ["-l", 1]
+  },
+  "metric3": {
+    "exec": "/bin/ls",
+    "type": "string",
+    "args": ["-l"],
+    "redact_args": [0.5]
+  },
+  "metric4": "/bin/ls"
+}`)
@@ -0,0 +1,116 @@
+// +build linux
+
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+
+Copyright 2016 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package collector
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// scriptDirPrefix prefix of name of private directory in which scripts defined in setfile are stored
+const scriptDirPrefix = "snap-plugin-collector-exec-"
+
+// scriptCache stores scripts defined in setfile as files named by hash of their content,
+// the files are written to private directory once and reused by subsequent executions
+type scriptCache struct {
+	mu    sync.Mutex
+	dir   string
+	files map[string]string
+}
+
+func newScriptCache() *scriptCache {
+	return &scriptCache{files: map[string]string{}}
+}
+
+// path returns path to file containing script, the file is created if it does not exist
+func (c *scriptCache) path(script string) (string, error) {
+	hash := scriptHash(script)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if path, ok := c.files[hash]; ok {
+		if _, err := os.Stat(path); err == nil {
+			return path, nil
+		}
+	}
+
+	if c.dir == "" {
+		//directory created by TempDir is accessible only by user running the plugin
+		dir, err := ioutil.TempDir("", scriptDirPrefix)
+		if err != nil {
+			return "", fmt.Errorf("Cannot create directory for scripts, %v", err)
+		}
+		c.dir = dir
+	}
+	if err := os.MkdirAll(c.dir, 0700); err != nil {
+		return "", fmt.Errorf("Cannot create directory for scripts, %v", err)
+	}
+
+	path := filepath.Join(c.dir, hash)
+	tmp, err := ioutil.TempFile(c.dir, hash+".tmp")
+	if err != nil {
+		return "", fmt.Errorf("Cannot write script, %v", err)
+	}
+	_, err = tmp.WriteString(script)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Chmod(tmp.Name(), 0400)
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), path)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return "", fmt.Errorf("Cannot write script, %v", err)
+	}
+
+	c.files[hash] = path
+	return path, nil
+}
+
+// close removes all stored scripts
+func (c *scriptCache) close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.dir == "" {
+		return nil
+	}
+	err := os.RemoveAll(c.dir)
+	c.dir = ""
+	c.files = map[string]string{}
+	return err
+}
+
+// scriptHash identifies content of script
+func scriptHash(script string) string {
+	hash := sha256.Sum256([]byte(script))
+	return hex.EncodeToString(hash[:])
+}
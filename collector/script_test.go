@@ -0,0 +1,166 @@
+// +build linux
+
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+
+Copyright 2016 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package collector
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/intelsdi-x/snap-plugin-lib-go/v1/plugin"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestScriptCache(t *testing.T) {
+	Convey("Storing scripts", t, func() {
+		c := newScriptCache()
+		defer c.close()
+
+		path, err := c.path("echo 1\n")
+		So(err, ShouldBeNil)
+		So(filepath.Base(path), ShouldEqual, scriptHash("echo 1\n"))
+		So(filepath.Base(filepath.Dir(path)), ShouldStartWith, scriptDirPrefix)
+
+		Convey("script is written to private directory", func() {
+			content, err := ioutil.ReadFile(path)
+			So(err, ShouldBeNil)
+			So(string(content), ShouldEqual, "echo 1\n")
+
+			fi, err := os.Stat(path)
+			So(err, ShouldBeNil)
+			So(fi.Mode().Perm(), ShouldEqual, os.FileMode(0400))
+			di, err := os.Stat(filepath.Dir(path))
+			So(err, ShouldBeNil)
+			So(di.Mode().Perm(), ShouldEqual, os.FileMode(0700))
+		})
+
+		Convey("the same script is stored once", func() {
+			again, err := c.path("echo 1\n")
+			So(err, ShouldBeNil)
+			So(again, ShouldEqual, path)
+			other, err := c.path("echo 2\n")
+			So(err, ShouldBeNil)
+			So(other, ShouldNotEqual, path)
+			entries, err := ioutil.ReadDir(filepath.Dir(path))
+			So(err, ShouldBeNil)
+			So(len(entries), ShouldEqual, 2)
+		})
+
+		Convey("removed script is written again", func() {
+			So(os.Remove(path), ShouldBeNil)
+			again, err := c.path("echo 1\n")
+			So(err, ShouldBeNil)
+			So(again, ShouldEqual, path)
+			_, err = os.Stat(path)
+			So(err, ShouldBeNil)
+		})
+
+		Convey("scripts are removed when cache is closed", func() {
+			So(c.close(), ShouldBeNil)
+			_, err := os.Stat(filepath.Dir(path))
+			So(os.IsNotExist(err), ShouldBeTrue)
+		})
+	})
+}
+
+func TestCollectMetricsScript(t *testing.T) {
+	Convey("Collecting metrics defined by scripts", t, func() {
+		dir, err := ioutil.TempDir("", "exec-script")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+		path := filepath.Join(dir, "setfile.yaml")
+
+		config := plugin.Config{}
+		config[setFileConfigVar] = path
+		config[execTimeOutConfigVar] = int64(10)
+
+		Convey("script is executed by interpreter with arguments", func() {
+			So(ioutil.WriteFile(path, []byte(`sum:
+  interpreter: /bin/sh
+  type: int64
+  args: ["2", "3"]
+  script: |
+    set -e
+    echo -n $(( $1 + $2 ))
+`), 0644), ShouldBeNil)
+
+			p := New()
+			defer p.Close()
+			results, err := p.CollectMetrics([]plugin.Metric{{Namespace: plugin.NewNamespace(vendor, pluginName, "sum"), Config: config}})
+			So(err, ShouldBeNil)
+			So(len(results), ShouldEqual, 1)
+			So(results[0].Data, ShouldEqual, 5)
+
+			Convey("and its file is removed when plugin is closed", func() {
+				scriptDir := p.scripts.dir
+				So(scriptDir, ShouldNotBeEmpty)
+				So(p.Close(), ShouldBeNil)
+				_, err := os.Stat(scriptDir)
+				So(os.IsNotExist(err), ShouldBeTrue)
+			})
+		})
+
+		Convey("script requires interpreter", func() {
+			So(ioutil.WriteFile(path, []byte("m:\n  type: string\n  script: echo 1\n"), 0644), ShouldBeNil)
+			_, serr := getMetricsFromConfig(path, "", false)
+			So(serr, ShouldNotBeNil)
+			So(serr.Error(), ShouldContainSubstring, "missing metric interpreter for m")
+		})
+
+		Convey("script and exec cannot be used together", func() {
+			So(ioutil.WriteFile(path, []byte("m:\n  type: string\n  exec: /bin/echo\n  interpreter: /bin/sh\n  script: echo 1\n"), 0644), ShouldBeNil)
+			_, serr := getMetricsFromConfig(path, "", false)
+			So(serr, ShouldNotBeNil)
+			So(serr.Error(), ShouldContainSubstring, "exec and script cannot be used together for m")
+		})
+
+		Convey("interpreter requires script", func() {
+			So(ioutil.WriteFile(path, []byte("m:\n  type: string\n  exec: /bin/echo\n  interpreter: /bin/sh\n"), 0644), ShouldBeNil)
+			_, serr := getMetricsFromConfig(path, "", false)
+			So(serr, ShouldNotBeNil)
+			So(serr.Error(), ShouldContainSubstring, "interpreter can be used only with script for m")
+		})
+
+		Convey("audit log contains hash of script and arguments defined in setfile", func() {
+			So(ioutil.WriteFile(path, []byte("m:\n  type: string\n  interpreter: /bin/sh\n  script: echo -n $1\n  args: [\"x\"]\n"), 0644), ShouldBeNil)
+			auditPath := filepath.Join(dir, "audit.log")
+			cfg := plugin.Config{}
+			for k, v := range config {
+				cfg[k] = v
+			}
+			cfg[auditLogConfigVar] = auditPath
+
+			p := New()
+			defer p.Close()
+			_, err := p.CollectMetrics([]plugin.Metric{{Namespace: plugin.NewNamespace(vendor, pluginName, "m"), Config: cfg}})
+			So(err, ShouldBeNil)
+			p.Close()
+
+			content, err := ioutil.ReadFile(auditPath)
+			So(err, ShouldBeNil)
+			So(strings.TrimSpace(string(content)), ShouldContainSubstring, `"script_sha256":"`+scriptHash("echo -n $1")+`"`)
+			So(string(content), ShouldContainSubstring, `"args":["x"]`)
+		})
+	})
+}
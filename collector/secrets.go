@@ -0,0 +1,173 @@
+// +build linux
+
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+
+Copyright 2016 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package collector
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/intelsdi-x/snap/core/serror"
+)
+
+const (
+	//secretFileSource secret is read from file, e.g. ${secret:file:/etc/exec/db.pass}
+	secretFileSource = "file"
+
+	//secretEnvSource secret is read from environment variable of plugin, e.g. ${secret:env:DB_PASS}
+	secretEnvSource = "env"
+
+	//scrubbedSecret replaces secret values in logs and errors
+	scrubbedSecret = "<secret>"
+)
+
+var secretRefRegexp = regexp.MustCompile(`\$\{secret:([^}]*)\}`)
+
+// hasSecretRef returns true if value contains secret reference
+func hasSecretRef(value string) bool {
+	return secretRefRegexp.MatchString(value)
+}
+
+// validateSecretRefs checks syntax of all secret references in value
+func validateSecretRefs(value string) error {
+	for _, match := range secretRefRegexp.FindAllStringSubmatch(value, -1) {
+		if _, _, err := parseSecretRef(match[1]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// resolveSecrets replaces secret references in value with secret values, resolved values are returned
+// to allow scrubbing them from logs and errors
+func resolveSecrets(value string) (string, []string, error) {
+	secrets := []string{}
+	var resolveErr error
+	resolved := secretRefRegexp.ReplaceAllStringFunc(value, func(ref string) string {
+		if resolveErr != nil {
+			return ref
+		}
+		source, name, err := parseSecretRef(secretRefRegexp.FindStringSubmatch(ref)[1])
+		if err != nil {
+			resolveErr = err
+			return ref
+		}
+		secret, err := readSecret(source, name)
+		if err != nil {
+			resolveErr = err
+			return ref
+		}
+		secrets = append(secrets, secret)
+		return secret
+	})
+	if resolveErr != nil {
+		return "", nil, resolveErr
+	}
+	return resolved, secrets, nil
+}
+
+// parseSecretRef splits body of secret reference into its source and name
+func parseSecretRef(ref string) (string, string, error) {
+	parts := strings.SplitN(ref, ":", 2)
+	if len(parts) != 2 || parts[1] == "" {
+		return "", "", fmt.Errorf("Incorrect secret reference ${secret:%s}, expected ${secret:<source>:<name>}", ref)
+	}
+	if parts[0] != secretFileSource && parts[0] != secretEnvSource {
+		return "", "", fmt.Errorf("Unsupported source of secret %s, expected %s or %s", parts[0], secretFileSource, secretEnvSource)
+	}
+	return parts[0], parts[1], nil
+}
+
+// readSecret reads secret value from its source
+func readSecret(source string, name string) (string, error) {
+	switch source {
+	case secretFileSource:
+		content, err := ioutil.ReadFile(name)
+		if err != nil {
+			return "", fmt.Errorf("Cannot read secret from file %s", name)
+		}
+		return strings.TrimRight(string(content), "\r\n"), nil
+	default:
+		secret, ok := os.LookupEnv(name)
+		if !ok {
+			return "", fmt.Errorf("Cannot read secret, environment variable %s is not set", name)
+		}
+		return secret, nil
+	}
+}
+
+// scrubSecrets replaces all secret values in s
+func scrubSecrets(s string, secrets []string) string {
+	for _, secret := range secrets {
+		if secret != "" {
+			s = strings.Replace(s, secret, scrubbedSecret, -1)
+		}
+	}
+	return s
+}
+
+// scrubError returns copy of error with secret values removed from its message and fields
+func scrubError(serr serror.SnapError, secrets []string) serror.SnapError {
+	if serr == nil || len(secrets) == 0 {
+		return serr
+	}
+
+	fields := map[string]interface{}{}
+	for k, v := range serr.Fields() {
+		switch value := v.(type) {
+		case string:
+			fields[k] = scrubSecrets(value, secrets)
+		case []byte:
+			fields[k] = scrubSecrets(string(value), secrets)
+		default:
+			fields[k] = v
+		}
+	}
+	return serror.New(fmt.Errorf("%s", scrubSecrets(serr.Error(), secrets)), fields)
+}
+
+// validateMetricSecrets checks that secrets are referenced only in env and stdin of metric,
+// values of arguments are visible to other users of the system, e.g. in output of ps
+func validateMetricSecrets(m metric) error {
+	if hasSecretRef(m.Exec) {
+		return fmt.Errorf("secret references are not allowed in exec, use env or stdin instead")
+	}
+	for _, arg := range m.Args {
+		if hasSecretRef(arg) {
+			return fmt.Errorf("secret references are not allowed in args, use env or stdin instead")
+		}
+	}
+	if hasSecretRef(m.Interpreter) {
+		return fmt.Errorf("secret references are not allowed in interpreter, use env or stdin instead")
+	}
+	if hasSecretRef(m.Cwd) {
+		return fmt.Errorf("secret references are not allowed in cwd, use env or stdin instead")
+	}
+	for _, value := range m.Env {
+		if err := validateSecretRefs(value); err != nil {
+			return err
+		}
+	}
+	return validateSecretRefs(m.Stdin)
+}
@@ -0,0 +1,101 @@
+// +build linux
+
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+
+Copyright 2016 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package collector
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/intelsdi-x/snap/core/serror"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestResolveSecrets(t *testing.T) {
+	Convey("Resolving secret references", t, func() {
+		dir, err := ioutil.TempDir("", "exec-secrets")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+
+		secretFile := filepath.Join(dir, "db.pass")
+		So(ioutil.WriteFile(secretFile, []byte("p4ss\n"), 0600), ShouldBeNil)
+		os.Setenv("EXEC_TEST_SECRET", "t0ken")
+		defer os.Unsetenv("EXEC_TEST_SECRET")
+
+		Convey("from file", func() {
+			value, secrets, err := resolveSecrets("${secret:file:" + secretFile + "}")
+			So(err, ShouldBeNil)
+			So(value, ShouldEqual, "p4ss")
+			So(secrets, ShouldResemble, []string{"p4ss"})
+		})
+
+		Convey("from environment variable", func() {
+			value, secrets, err := resolveSecrets("user:${secret:env:EXEC_TEST_SECRET}")
+			So(err, ShouldBeNil)
+			So(value, ShouldEqual, "user:t0ken")
+			So(secrets, ShouldResemble, []string{"t0ken"})
+		})
+
+		Convey("when value does not contain references", func() {
+			value, secrets, err := resolveSecrets("plain")
+			So(err, ShouldBeNil)
+			So(value, ShouldEqual, "plain")
+			So(secrets, ShouldBeEmpty)
+		})
+
+		Convey("when secret is not available", func() {
+			_, _, err := resolveSecrets("${secret:env:EXEC_TEST_MISSING_SECRET}")
+			So(err, ShouldNotBeNil)
+			_, _, err = resolveSecrets("${secret:file:" + filepath.Join(dir, "missing") + "}")
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("when reference is incorrect", func() {
+			So(validateSecretRefs("${secret:vault:db}"), ShouldNotBeNil)
+			So(validateSecretRefs("${secret:file}"), ShouldNotBeNil)
+			So(validateSecretRefs("${secret:env:DB_PASS}"), ShouldBeNil)
+		})
+	})
+}
+
+func TestValidateMetricSecrets(t *testing.T) {
+	Convey("Validating secret references in metric definition", t, func() {
+		So(validateMetricSecrets(metric{Exec: "/bin/sh", Env: map[string]string{"PASS": "${secret:env:PASS}"}}), ShouldBeNil)
+		So(validateMetricSecrets(metric{Exec: "/bin/sh", Stdin: "${secret:file:/etc/pass}"}), ShouldBeNil)
+		So(validateMetricSecrets(metric{Exec: "/bin/sh", Args: []string{"${secret:env:PASS}"}}), ShouldNotBeNil)
+		So(validateMetricSecrets(metric{Exec: "${secret:env:PASS}"}), ShouldNotBeNil)
+	})
+}
+
+func TestScrubError(t *testing.T) {
+	Convey("Scrubbing secrets from errors", t, func() {
+		serr := serror.New(fmt.Errorf("cannot login with p4ss"), map[string]interface{}{"output": []byte("p4ss"), exitCodeField: 1})
+		scrubbed := scrubError(serr, []string{"p4ss"})
+		So(scrubbed.Error(), ShouldEqual, "cannot login with "+scrubbedSecret)
+		So(scrubbed.Fields()["output"], ShouldEqual, scrubbedSecret)
+		So(scrubbed.Fields()[exitCodeField], ShouldEqual, 1)
+
+		So(scrubError(nil, []string{"p4ss"}), ShouldBeNil)
+	})
+}
@@ -0,0 +1,377 @@
+// +build linux
+
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+
+Copyright 2016 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package collector
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"syscall"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/intelsdi-x/snap/core/serror"
+)
+
+// setFile immutable snapshot of metrics configuration loaded from setfile,
+// it is replaced as a whole when setfile is reloaded, so it can be safely shared between goroutines
+type setFile struct {
+	path    string
+	format  string
+	strict  bool
+	watched []string
+	version string
+	metrics map[string]metric
+}
+
+// setFileKey identifies settings which affect loading of setfile
+type setFileKey struct {
+	path   string
+	format string
+	strict bool
+}
+
+// setFileState the last valid snapshot of setfile loaded with given settings and the last invalid one,
+// which is not read again until its files are modified
+type setFileState struct {
+	current *setFile
+	failed  *setFile
+}
+
+// currentSetFile returns the setfile returned by the last successful loading
+func (p *Plugin) currentSetFile() *setFile {
+	return p.setFile.Load().(*setFile)
+}
+
+// loadSetFile returns metrics configuration from setfile, snapshots are kept for each combination of settings
+// which affect loading, so tasks with different settings do not replace each other's snapshot,
+// the files are read again only when any of them was modified,
+// if modified setfile is invalid the last valid configuration is kept
+func (p *Plugin) loadSetFile(setFilePath string, setFileFormat string, strictPermissions bool) (*setFile, serror.SnapError) {
+	p.reloadMu.Lock()
+	defer p.reloadMu.Unlock()
+
+	key := setFileKey{path: setFilePath, format: setFileFormat, strict: strictPermissions}
+	state, ok := p.setFiles[key]
+	if !ok {
+		state = &setFileState{}
+		p.setFiles[key] = state
+	}
+	current := state.current
+
+	if current != nil && filesVersion(current.watched) == current.version {
+		p.setFile.Store(current)
+		return current, nil
+	}
+	if current != nil && state.failed != nil && filesVersion(state.failed.watched) == state.failed.version {
+		p.setFile.Store(current)
+		return current, nil
+	}
+
+	loaded, serr := getMetricsFromConfig(setFilePath, setFileFormat, strictPermissions)
+	if serr != nil {
+		state.failed = loaded
+		if current != nil {
+			log.WithFields(serr.Fields()).Error(serr.Error())
+			log.WithFields(map[string]interface{}{"setFilePath": setFilePath}).Warn("Settings file is invalid, the last valid configuration is used")
+			p.setFile.Store(current)
+			return current, nil
+		}
+		return nil, serr
+	}
+
+	if current == nil {
+		current = &setFile{metrics: map[string]metric{}}
+	}
+	logSetFileDiff(current, loaded)
+	state.current = loaded
+	state.failed = nil
+	p.setFile.Store(loaded)
+
+	return loaded, nil
+}
+
+// setFileLoader reads setfile fragments and merges metrics defined in them
+type setFileLoader struct {
+	setFile     *setFile
+	visited     map[string]bool
+	definitions map[string]interface{}
+	defaults    map[string]interface{}
+	templates   map[string]interface{}
+	positions   map[string]position //positions of metrics, templates and their fields identified by keyPath
+}
+
+func newSetFileLoader(setFilePath string, setFileFormat string, strictPermissions bool) *setFileLoader {
+	return &setFileLoader{
+		setFile:     &setFile{path: setFilePath, format: setFileFormat, strict: strictPermissions},
+		visited:     map[string]bool{},
+		definitions: map[string]interface{}{},
+		templates:   map[string]interface{}{},
+		positions:   map[string]position{},
+	}
+}
+
+// watch adds path to files which are checked for modifications
+func (l *setFileLoader) watch(path string) {
+	l.setFile.watched = append(l.setFile.watched, path)
+	l.setFile.version += fileVersion(path)
+}
+
+// loadPath loads all setfiles defined by path
+func (l *setFileLoader) loadPath(path string, logFields map[string]interface{}) serror.SnapError {
+	files, dirs, err := expandSetFilePath(path, l.setFile.format)
+	for _, dir := range dirs {
+		l.watch(dir)
+	}
+	if err != nil {
+		l.watch(path)
+		return serror.New(err, logFields)
+	}
+
+	for _, file := range files {
+		if serr := l.loadFile(file); serr != nil {
+			return serr
+		}
+	}
+	return nil
+}
+
+// loadFile loads single setfile and setfiles included by it, files which were already loaded are skipped
+func (l *setFileLoader) loadFile(path string) serror.SnapError {
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		absPath = path
+	}
+	if l.visited[absPath] {
+		return nil
+	}
+	l.visited[absPath] = true
+	l.watch(path)
+
+	logFields := map[string]interface{}{}
+	logFields["setFilePath"] = path
+
+	setFileContent, err := ioutil.ReadFile(path)
+	logFields["setFileContent"] = setFileContent
+	if err != nil {
+		return serror.New(err, logFields)
+	}
+
+	if len(setFileContent) == 0 {
+		return serror.New(fmt.Errorf("Settings file is empty"), logFields)
+	}
+
+	serr := verifyPermissions(path, l.setFile.strict, map[string]interface{}{"setFilePath": path})
+	if serr != nil {
+		return serr
+	}
+
+	setFileUnmarshalled, positions, err := decodeSetFile(path, setFileContent, l.setFile.format)
+	if err != nil {
+		if pos, ok := jsonErrorPosition(path, setFileContent, err); ok {
+			return serror.New(fmt.Errorf("Settings file cannot be unmarshalled, %v at %s", err, pos), logFields)
+		}
+		return serror.New(fmt.Errorf("Settings file cannot be unmarshalled, %v in %s", err, path), logFields)
+	}
+
+	includes, err := stringsOf(includeMapKey, setFileUnmarshalled[includeMapKey])
+	if err != nil {
+		return serror.New(err, logFields)
+	}
+	delete(setFileUnmarshalled, includeMapKey)
+	delete(setFileUnmarshalled, schemaMapKey)
+
+	if serr := l.addShared(setFileUnmarshalled, positions, logFields); serr != nil {
+		return serr
+	}
+
+	names := make([]string, 0, len(setFileUnmarshalled))
+	for name := range setFileUnmarshalled {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		pos, ok := positions[keyPath(name)]
+		if !ok {
+			pos = position{file: path}
+		}
+		if _, ok := l.definitions[name]; ok {
+			return serror.New(fmt.Errorf("Metric %s is defined more than once, in %s and in %s", name, l.positions[keyPath(name)], pos), logFields)
+		}
+		l.definitions[name] = setFileUnmarshalled[name]
+		for k, p := range positions {
+			if k == name || strings.HasPrefix(k, name+".") {
+				l.positions[k] = p
+			}
+		}
+		l.positions[keyPath(name)] = pos
+	}
+
+	for _, include := range includes {
+		if !filepath.IsAbs(include) {
+			include = filepath.Join(filepath.Dir(path), include)
+		}
+		if serr := l.loadPath(include, logFields); serr != nil {
+			return serr
+		}
+	}
+
+	return nil
+}
+
+// stringsOf returns value of key which can be a string or a list of strings
+func stringsOf(key string, value interface{}) ([]string, error) {
+	switch v := value.(type) {
+	case nil:
+		return nil, nil
+	case string:
+		return []string{v}, nil
+	case []interface{}:
+		values := []string{}
+		for _, i := range v {
+			s, ok := i.(string)
+			if !ok {
+				return nil, fmt.Errorf("Incorrect structure of settings file, %s must be a string or a list of strings", key)
+			}
+			values = append(values, s)
+		}
+		return values, nil
+	default:
+		return nil, fmt.Errorf("Incorrect structure of settings file, %s must be a string or a list of strings", key)
+	}
+}
+
+// expandSetFilePath returns setfiles defined by path in lexical order, path can be a file, a directory
+// or a glob pattern, directories which are watched for new setfiles are returned too
+func expandSetFilePath(path string, format string) ([]string, []string, error) {
+	if strings.ContainsAny(path, "*?[") {
+		matches, err := filepath.Glob(path)
+		if err != nil {
+			return nil, nil, err
+		}
+		files := []string{}
+		dirs := []string{}
+		seenDirs := map[string]bool{}
+		for _, match := range matches {
+			fi, err := os.Stat(match)
+			if err != nil || !fi.Mode().IsRegular() {
+				continue
+			}
+			files = append(files, match)
+			if dir := filepath.Dir(match); !seenDirs[dir] {
+				seenDirs[dir] = true
+				dirs = append(dirs, dir)
+			}
+		}
+		if dir := filepath.Dir(path); !strings.ContainsAny(dir, "*?[") && !seenDirs[dir] {
+			dirs = append(dirs, dir)
+		}
+		sort.Strings(files)
+		if len(files) == 0 {
+			return nil, dirs, fmt.Errorf("No settings files match %s", path)
+		}
+		return files, dirs, nil
+	}
+
+	fi, err := os.Stat(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !fi.IsDir() {
+		return []string{path}, nil, nil
+	}
+
+	entries, err := ioutil.ReadDir(path)
+	if err != nil {
+		return nil, []string{path}, err
+	}
+	files := []string{}
+	for _, entry := range entries {
+		if entry.Mode().IsRegular() && hasSetFileExtension(entry.Name(), format) {
+			files = append(files, filepath.Join(path, entry.Name()))
+		}
+	}
+	if len(files) == 0 {
+		return nil, []string{path}, fmt.Errorf("No settings files found in %s", path)
+	}
+	return files, []string{path}, nil
+}
+
+// filesVersion identifies content of files, any modification, replacement or change of permissions
+// of any of the files changes the version
+func filesVersion(paths []string) string {
+	version := ""
+	for _, path := range paths {
+		version += fileVersion(path)
+	}
+	return version
+}
+
+// fileVersion identifies content of single file or directory
+func fileVersion(path string) string {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return fmt.Sprintf("%s:%v;", path, err)
+	}
+
+	version := fmt.Sprintf("%s:%d:%d", path, fi.Size(), fi.ModTime().UnixNano())
+	if st, ok := fi.Sys().(*syscall.Stat_t); ok {
+		version += fmt.Sprintf(":%d:%d:%d:%d", st.Dev, st.Ino, st.Ctim.Sec, st.Ctim.Nsec)
+	}
+	return version + ";"
+}
+
+// logSetFileDiff logs metrics which were added, removed or changed in reloaded setfile
+func logSetFileDiff(previous *setFile, current *setFile) {
+	added := []string{}
+	removed := []string{}
+	changed := []string{}
+
+	for name, m := range current.metrics {
+		prev, ok := previous.metrics[name]
+		if !ok {
+			added = append(added, name)
+		} else if !reflect.DeepEqual(prev, m) {
+			changed = append(changed, name)
+		}
+	}
+	for name := range previous.metrics {
+		if _, ok := current.metrics[name]; !ok {
+			removed = append(removed, name)
+		}
+	}
+
+	sort.Strings(added)
+	sort.Strings(removed)
+	sort.Strings(changed)
+
+	log.WithFields(map[string]interface{}{
+		"setFilePath": current.path,
+		"added":       added,
+		"removed":     removed,
+		"changed":     changed,
+	}).Info("Settings file loaded")
+}
@@ -0,0 +1,214 @@
+// +build linux
+
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+
+Copyright 2016 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package collector
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestLoadSetFile(t *testing.T) {
+	Convey("Loading setfile", t, func() {
+		createMockFile(mockFileCont)
+		defer deleteMockFile()
+
+		plg := New()
+		loaded, serr := plg.loadSetFile(mockFilePath, "", false)
+		So(serr, ShouldBeNil)
+		So(len(loaded.metrics), ShouldEqual, 5)
+		So(plg.currentSetFile(), ShouldEqual, loaded)
+
+		Convey("when setfile is not modified, it is not reloaded", func() {
+			reloaded, serr := plg.loadSetFile(mockFilePath, "", false)
+			So(serr, ShouldBeNil)
+			So(reloaded, ShouldEqual, loaded)
+		})
+
+		Convey("when loading settings change, setfile is reloaded", func() {
+			reloaded, serr := plg.loadSetFile(mockFilePath, "", true)
+			So(serr, ShouldBeNil)
+			So(reloaded, ShouldNotEqual, loaded)
+		})
+
+		Convey("snapshots loaded with different settings do not replace each other", func() {
+			strict, serr := plg.loadSetFile(mockFilePath, "", true)
+			So(serr, ShouldBeNil)
+
+			reloaded, serr := plg.loadSetFile(mockFilePath, "", false)
+			So(serr, ShouldBeNil)
+			So(reloaded, ShouldEqual, loaded)
+			So(plg.currentSetFile(), ShouldEqual, loaded)
+
+			reloaded, serr = plg.loadSetFile(mockFilePath, "", true)
+			So(serr, ShouldBeNil)
+			So(reloaded, ShouldEqual, strict)
+			So(plg.currentSetFile(), ShouldEqual, strict)
+		})
+
+		Convey("when setfile is modified, it is reloaded", func() {
+			createMockFile(mockFileContSecrets)
+			reloaded, serr := plg.loadSetFile(mockFilePath, "", false)
+			So(serr, ShouldBeNil)
+			So(reloaded, ShouldNotEqual, loaded)
+			So(len(reloaded.metrics), ShouldEqual, 1)
+			So(plg.currentSetFile(), ShouldEqual, reloaded)
+		})
+
+		Convey("when modified setfile is invalid, the last valid configuration is kept", func() {
+			createMockFile(mockFileContMissingType)
+			reloaded, serr := plg.loadSetFile(mockFilePath, "", false)
+			So(serr, ShouldBeNil)
+			So(reloaded, ShouldEqual, loaded)
+
+			Convey("until it is fixed", func() {
+				createMockFile(mockFileContSecrets)
+				reloaded, serr := plg.loadSetFile(mockFilePath, "", false)
+				So(serr, ShouldBeNil)
+				So(len(reloaded.metrics), ShouldEqual, 1)
+			})
+		})
+
+		Convey("when setfile is removed, the last valid configuration is kept", func() {
+			deleteMockFile()
+			reloaded, serr := plg.loadSetFile(mockFilePath, "", false)
+			So(serr, ShouldBeNil)
+			So(reloaded, ShouldEqual, loaded)
+		})
+
+		Convey("when other setfile is invalid, error is returned", func() {
+			_, serr := plg.loadSetFile("./missing_setfile.json", "", false)
+			So(serr, ShouldNotBeNil)
+			So(plg.currentSetFile(), ShouldEqual, loaded)
+		})
+	})
+}
+
+func TestSetFileFragments(t *testing.T) {
+	Convey("Loading setfile fragments", t, func() {
+		dir, err := ioutil.TempDir("", "exec-setfiles")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+
+		confDir := filepath.Join(dir, "conf.d")
+		So(os.Mkdir(confDir, 0755), ShouldBeNil)
+		writeFragment(confDir, "10-db.json", `{
+	"db_connections": {"exec": "/bin/echo", "type": "int64", "args": ["1"]}
+}`)
+		writeFragment(confDir, "20-web.json", `{
+	"web_requests": {"exec": "/bin/echo", "type": "int64", "args": ["2"]},
+	"include": "../shared/*.json"
+}`)
+		writeFragment(confDir, "README", "not a setfile")
+		So(os.Mkdir(filepath.Join(dir, "shared"), 0755), ShouldBeNil)
+		writeFragment(filepath.Join(dir, "shared"), "common.json", `{
+	"uptime": {"exec": "/bin/echo", "type": "int64", "args": ["3"]}
+}`)
+
+		Convey("from directory with includes", func() {
+			loaded, serr := getMetricsFromConfig(confDir, "", false)
+			So(serr, ShouldBeNil)
+			So(len(loaded.metrics), ShouldEqual, 3)
+			So(loaded.metrics, ShouldContainKey, "uptime")
+		})
+
+		Convey("from glob pattern", func() {
+			loaded, serr := getMetricsFromConfig(filepath.Join(confDir, "1*.json"), "", false)
+			So(serr, ShouldBeNil)
+			So(len(loaded.metrics), ShouldEqual, 1)
+			So(loaded.metrics, ShouldContainKey, "db_connections")
+		})
+
+		Convey("when glob pattern does not match any file", func() {
+			_, serr := getMetricsFromConfig(filepath.Join(confDir, "*.yaml"), "", false)
+			So(serr, ShouldNotBeNil)
+		})
+
+		Convey("when the same metric is defined in two fragments", func() {
+			writeFragment(confDir, "30-dup.json", `{
+	"include": [],
+
+	"db_connections": {"exec": "/bin/echo", "type": "int64", "args": ["4"]}
+}`)
+			_, serr := getMetricsFromConfig(confDir, "", false)
+			So(serr, ShouldNotBeNil)
+			So(serr.Error(), ShouldContainSubstring, filepath.Join(confDir, "10-db.json")+":2:2")
+			So(serr.Error(), ShouldContainSubstring, filepath.Join(confDir, "30-dup.json")+":4:2")
+		})
+
+		Convey("when include is incorrect", func() {
+			writeFragment(confDir, "30-inc.json", `{"include": 1}`)
+			_, serr := getMetricsFromConfig(confDir, "", false)
+			So(serr, ShouldNotBeNil)
+		})
+
+		Convey("when included file does not exist", func() {
+			writeFragment(confDir, "30-inc.json", `{"include": "missing.json"}`)
+			_, serr := getMetricsFromConfig(confDir, "", false)
+			So(serr, ShouldNotBeNil)
+		})
+
+		Convey("when fragments include each other", func() {
+			writeFragment(filepath.Join(dir, "shared"), "common.json", `{
+	"uptime": {"exec": "/bin/echo", "type": "int64", "args": ["3"]},
+	"include": "../conf.d/20-web.json"
+}`)
+			loaded, serr := getMetricsFromConfig(confDir, "", false)
+			So(serr, ShouldBeNil)
+			So(len(loaded.metrics), ShouldEqual, 3)
+		})
+
+		Convey("and reloading directory", func() {
+			plg := New()
+			loaded, serr := plg.loadSetFile(confDir, "", false)
+			So(serr, ShouldBeNil)
+
+			Convey("when new fragment is added", func() {
+				writeFragment(confDir, "40-new.json", `{"new_metric": {"exec": "/bin/echo", "type": "int64"}}`)
+				reloaded, serr := plg.loadSetFile(confDir, "", false)
+				So(serr, ShouldBeNil)
+				So(len(reloaded.metrics), ShouldEqual, 4)
+			})
+
+			Convey("when included fragment is modified", func() {
+				writeFragment(filepath.Join(dir, "shared"), "common.json", `{}`)
+				reloaded, serr := plg.loadSetFile(confDir, "", false)
+				So(serr, ShouldBeNil)
+				So(len(reloaded.metrics), ShouldEqual, 2)
+			})
+
+			Convey("when nothing changes", func() {
+				reloaded, serr := plg.loadSetFile(confDir, "", false)
+				So(serr, ShouldBeNil)
+				So(reloaded, ShouldEqual, loaded)
+			})
+		})
+	})
+}
+
+func writeFragment(dir string, name string, content string) {
+	ioutil.WriteFile(filepath.Join(dir, name), []byte(strings.TrimSpace(content)), 0644)
+}
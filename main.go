@@ -23,21 +23,32 @@ package main
 
 import (
 	"os"
+	"path/filepath"
 
 	"github.com/intelsdi-x/snap-plugin-collector-exec/collector"
-	"github.com/intelsdi-x/snap/control/plugin"
+	"github.com/intelsdi-x/snap-plugin-lib-go/v1/plugin"
 )
 
 func main() {
 
+	//subcommands allow to test setfile without snap daemon
+	if code, ok := collector.RunCommand(filepath.Base(os.Args[0]), os.Args[1:], os.Stdout, os.Stderr); ok {
+		os.Exit(code)
+	}
+
 	plg := collector.New()
 	if plg == nil {
 		panic("Plugin could not be initialized")
 	}
 
-	plugin.Start(
-		collector.Meta(),
+	code := plugin.StartCollector(
 		plg,
-		os.Args[1],
+		collector.PluginName,
+		collector.PluginVersion,
+		collector.Meta()...,
 	)
+
+	//remove scripts stored by plugin
+	plg.Close()
+	os.Exit(code)
 }